@@ -1,27 +1,70 @@
 package app
 
 import (
-	"bytes"
-	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/codecrafters-io/http-server-starter-go/http"
 )
 
+const (
+	defaultShutdownTimeout = 10 * time.Second
+
+	defaultMaxDecompressedBodySize = 64 << 20 // 64MB
+)
+
 type Config struct {
 	Directory string
 	Logger    *slog.Logger
 	Port      int
+
+	// ShutdownTimeout is how long Stop waits for in-flight requests to
+	// finish before closing their connections. Defaults to 10 seconds.
+	ShutdownTimeout time.Duration
+
+	// Connection timeouts, see http.Server. Zero means no timeout.
+	ReadHeaderTimeout time.Duration
+	ReadBodyTimeout   time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// Connection limits, see http.Server. Zero means no limit.
+	MaxConns        int
+	MaxConnsPerIP   int
+	RejectOverLimit bool
+
+	// TLSCertificates turns on HTTPS, see http.Server.Certificates.
+	TLSCertificates []http.CertificateFiles
+
+	// ServerHeader is sent in the Server header of every response. Empty
+	// means no Server header.
+	ServerHeader string
+
+	// ContentTypes maps file extensions, i.e. ".md", to the content type of
+	// the files served with them, adding to or overriding the built-in table
+	// of http.TypeByExtension. Extensions are matched regardless of case.
+	// Files with an unknown extension get the content type detected from
+	// their first bytes.
+	ContentTypes map[string]string
+
+	// MaxDecompressedBodySize limits the size of uploaded files sent with a
+	// gzip or deflate Content-Encoding once decompressed. Defaults to 64MB.
+	MaxDecompressedBodySize int64
 }
 
 type App struct {
 	mux    *http.Mux
 	server *http.Server
+	files  *fileRoot
+
+	// contentTypes is Config.ContentTypes by lower-case extension
+	contentTypes map[string]string
 
 	Config            *Config
 	HTTPServerCreated chan bool
@@ -33,18 +76,47 @@ func NewApp(config *Config) *App {
 		HTTPServerCreated: make(chan bool, 1),
 	}
 
+	files, filesErr := openFileRoot(config.Directory)
+	if filesErr != nil {
+		config.Logger.Error("cannot serve files", "error", filesErr)
+		os.Exit(1)
+	}
+	app.files = files
+
+	contentTypes, typesErr := lowerExtensions(config.ContentTypes)
+	if typesErr != nil {
+		config.Logger.Error("invalid content types", "error", typesErr)
+		os.Exit(1)
+	}
+	app.contentTypes = contentTypes
+
 	mux := http.NewMux(config.Logger)
+	mux.Use(app.logRequestMiddleware, http.Compress(http.DefaultCompressMinSize))
 	mux.HandleFunc("GET /", app.homeHandler)
 	mux.HandleFunc("GET /user-agent", app.getUserAgentHandler)
-	mux.HandleFunc("GET /echo/{str}", app.echoHandler)
-	mux.HandleFunc("GET /files/{filename}", app.readFileHandler)
-	mux.HandleFunc("POST /files/{filename}", app.createFileHandler)
+	// echoed strings are compressed however short they are
+	mux.HandleFunc("GET /echo/{str}", app.echoHandler, http.Compress(0))
+	mux.HandleFunc("GET /files/{filename...}", app.readFileHandler)
+	maxDecompressedBodySize := config.MaxDecompressedBodySize
+	if maxDecompressedBodySize == 0 {
+		maxDecompressedBodySize = defaultMaxDecompressedBodySize
+	}
+	mux.HandleFunc("POST /files/{filename...}", app.createFileHandler, http.DecompressBody(maxDecompressedBodySize))
 
 	server, err := http.NewServer(fmt.Sprintf(":%v", config.Port), mux, config.Logger)
 	if err != nil {
 		config.Logger.Error("cannot create HTTP server", "error", err)
 		os.Exit(1)
 	}
+	server.ReadHeaderTimeout = config.ReadHeaderTimeout
+	server.ReadBodyTimeout = config.ReadBodyTimeout
+	server.WriteTimeout = config.WriteTimeout
+	server.IdleTimeout = config.IdleTimeout
+	server.MaxConns = config.MaxConns
+	server.MaxConnsPerIP = config.MaxConnsPerIP
+	server.RejectOverLimit = config.RejectOverLimit
+	server.Certificates = config.TLSCertificates
+	server.ServerHeader = config.ServerHeader
 
 	app.mux = mux
 	app.server = server
@@ -52,86 +124,126 @@ func NewApp(config *Config) *App {
 	return app
 }
 
+// lowerExtensions returns types with lower-case extensions, which is how
+// http.TypeByExtension looks them up. Extensions differing only in case must
+// have the same content type.
+func lowerExtensions(types map[string]string) (map[string]string, error) {
+	lowered := make(map[string]string, len(types))
+	for ext, contentType := range types {
+		key := strings.ToLower(ext)
+		existing, found := lowered[key]
+		if found && existing != contentType {
+			return nil, fmt.Errorf("extension %v has both content types %q and %q", key, existing, contentType)
+		}
+		lowered[key] = contentType
+	}
+
+	return lowered, nil
+}
+
 func (a *App) Start() error {
 	go func() {
 		a.HTTPServerCreated <- <-a.server.Created
 	}()
 
 	err := a.server.Start()
-	if err != nil {
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("cannot start HTTP server: %w", err)
 	}
 
 	return nil
 }
 
+// Stop gracefully shuts down the HTTP server, waiting at most
+// Config.ShutdownTimeout for in-flight requests to finish.
 func (a *App) Stop() error {
-	err := a.server.Stop()
+	timeout := a.Config.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := a.server.Shutdown(ctx)
+	// connections are all closed by now, even if Shutdown timed out
+	closeErr := a.files.Close()
 	if err != nil {
 		return fmt.Errorf("cannot stop HTTP server: %w", err)
 	}
 
+	if closeErr != nil {
+		return fmt.Errorf("cannot close files directory: %w", closeErr)
+	}
+
 	return nil
 }
 
 func (a *App) homeHandler(req *http.Request, resp *http.Response) {
-	resp.StatusCode = 200
+	resp.StatusCode = http.StatusOK
 }
 
 func (a *App) getUserAgentHandler(req *http.Request, resp *http.Response) {
-	resp.StatusCode = 200
-	resp.Headers["Content-Type"] = "text/plain"
-	resp.Body = []byte(req.Headers["User-Agent"])
+	resp.StatusCode = http.StatusOK
+	resp.Headers.Set("Content-Type", "text/plain")
+	resp.Body = []byte(req.Headers.Get("User-Agent"))
 }
 
 func (a *App) echoHandler(req *http.Request, resp *http.Response) {
-	resp.StatusCode = 200
-	resp.Headers["Content-Type"] = "text/plain"
+	resp.StatusCode = http.StatusOK
+	resp.Headers.Set("Content-Type", "text/plain")
 	resp.Body = []byte(req.Params["str"])
-
-	if strings.Contains(req.Headers["Accept-Encoding"], "gzip") {
-		body, err := gzipCompress(resp.Body)
-		if err != nil {
-			a.Config.Logger.Error("cannot gzip response", "error", err, "str", req.Params["str"])
-			resp.StatusCode = 500
-			resp.Body = []byte("cannot gzip")
-			return
-		}
-
-		resp.Headers["Content-Encoding"] = "gzip"
-		resp.Body = body
-	}
 }
 
 func (a *App) readFileHandler(req *http.Request, resp *http.Response) {
-	filepath := filepath.Join(a.Config.Directory, req.Params["filename"])
-	file, openErr := os.Open(filepath)
+	filename := req.Params["filename"]
+	file, openErr := a.files.Open(filename)
+	if errors.Is(openErr, errOutsideRoot) {
+		a.Config.Logger.Warn("refusing file outside of the files directory", "filename", filename)
+		resp.StatusCode = http.StatusForbidden
+		return
+	}
 	if openErr != nil {
 		a.Config.Logger.Warn("cannot open file", "error", openErr)
-		resp.StatusCode = 404
+		resp.StatusCode = http.StatusNotFound
 		return
 	}
-	defer file.Close()
 
-	body, readErr := io.ReadAll(file)
-	if readErr != nil {
-		a.Config.Logger.Error("error reading file", "error", readErr, "filepath", filepath)
-		resp.StatusCode = 500
-		resp.Body = []byte("cannot read from file")
+	info, statErr := file.Stat()
+	if statErr != nil || info.IsDir() {
+		a.Config.Logger.Warn("cannot serve file", "error", statErr, "filename", filename)
+		file.Close()
+		resp.StatusCode = http.StatusNotFound
 		return
 	}
 
-	resp.StatusCode = 200
-	resp.Headers["Content-Type"] = "application/octet-stream"
-	resp.Body = body
+	// the file is streamed to the client and closed once the handler returns
+
+	contentType := http.TypeByExtension(path.Ext(filename), a.contentTypes)
+	if contentType != "" {
+		resp.Headers.Set("Content-Type", contentType)
+	}
+	resp.Headers.Set("ETag", http.FileETag(info.Size(), info.ModTime()))
+	serveErr := http.ServeContent(req, resp, file, info.Size(), info.ModTime())
+	if serveErr != nil {
+		a.Config.Logger.Error("error reading file", "error", serveErr, "filename", filename)
+		resp.Headers.Del("Content-Range")
+		resp.StatusCode = http.StatusInternalServerError
+		resp.Body = []byte("cannot read from file")
+	}
 }
 
 func (a *App) createFileHandler(req *http.Request, resp *http.Response) {
-	filepath := filepath.Join(a.Config.Directory, req.Params["filename"])
-	file, createErr := os.Create(filepath)
+	filename := req.Params["filename"]
+	file, createErr := a.files.Create(filename)
+	if errors.Is(createErr, errOutsideRoot) {
+		a.Config.Logger.Warn("refusing file outside of the files directory", "filename", filename)
+		resp.StatusCode = http.StatusForbidden
+		return
+	}
 	if createErr != nil {
 		a.Config.Logger.Error("error creating file", "error", createErr)
-		resp.StatusCode = 500
+		resp.StatusCode = http.StatusInternalServerError
 		resp.Body = []byte("cannot create file")
 		return
 	}
@@ -140,26 +252,10 @@ func (a *App) createFileHandler(req *http.Request, resp *http.Response) {
 	_, writeErr := file.Write(req.Body)
 	if writeErr != nil {
 		a.Config.Logger.Error("error writing file", "error", writeErr)
-		resp.StatusCode = 500
+		resp.StatusCode = http.StatusInternalServerError
 		resp.Body = []byte("cannot write to file")
 		return
 	}
 
-	resp.StatusCode = 201
-}
-
-func gzipCompress(data []byte) ([]byte, error) {
-	buf := bytes.NewBuffer(nil)
-	zw := gzip.NewWriter(buf)
-
-	_, writeErr := zw.Write(data)
-	if writeErr != nil {
-		return nil, writeErr
-	}
-	zw.Flush()
-	// Close gzip writer before reading from buffer
-	// to make sure that gzip footer is written to the buffer
-	zw.Close()
-
-	return buf.Bytes(), nil
+	resp.StatusCode = http.StatusCreated
 }
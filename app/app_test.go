@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptrace"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/codecrafters-io/http-server-starter-go/app"
@@ -22,6 +23,10 @@ func TestHandlers(t *testing.T) {
 		Directory: "./../testdata",
 		Port:      8181,
 		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ContentTypes: map[string]string{
+			".note": "text/x-note",
+			".LOG":  "text/x-log",
+		},
 	}
 
 	testApp := app.NewApp(cfg)
@@ -85,6 +90,20 @@ func TestHandlers(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedBody:   []byte("bar"),
 		},
+		{
+			name:           "GET /echo/foo?x=1",
+			method:         "GET",
+			path:           "/echo/foo?x=1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   []byte("foo"),
+		},
+		{
+			name:           "GET /echo/hello%20world",
+			method:         "GET",
+			path:           "/echo/hello%20world",
+			expectedStatus: http.StatusOK,
+			expectedBody:   []byte("hello world"),
+		},
 		{
 			name:           "GET /files/test",
 			method:         "GET",
@@ -172,6 +191,242 @@ func TestHandlers(t *testing.T) {
 		}
 	})
 
+	t.Run("POST /files/sub/dir/new-file", func(tt *testing.T) {
+		err := os.RemoveAll("./../testdata/sub")
+		if err != nil {
+			tt.Fatalf("failed to remove directory: %v", err)
+		}
+		defer os.RemoveAll("./../testdata/sub")
+
+		ctx := context.Background()
+		body := []byte("nested")
+		url := fmt.Sprintf("http://localhost:%d/files/sub/dir/new-file", cfg.Port)
+
+		resp1, err := sendRequest(ctx, request{method: http.MethodPost, url: url, body: bytes.NewBuffer(body)})
+		if err != nil {
+			tt.Fatalf("failed to send request: %v", err)
+		}
+
+		if resp1.status != http.StatusCreated {
+			tt.Fatalf("unexpected status code: got %v, want %v", resp1.status, http.StatusCreated)
+		}
+
+		resp2, err := sendRequest(ctx, request{method: http.MethodGet, url: url})
+		if err != nil {
+			tt.Fatalf("failed to send request: %v", err)
+		}
+
+		if resp2.status != http.StatusOK {
+			tt.Fatalf("unexpected status code: got %v, want %v", resp2.status, http.StatusOK)
+		}
+
+		if !bytes.Equal(resp2.body, body) {
+			tt.Fatalf("unexpected response body: got %q, want %q", resp2.body, body)
+		}
+	})
+
+	t.Run("GET /files/test with Range", func(tt *testing.T) {
+		url := fmt.Sprintf("http://localhost:%d/files/test", cfg.Port)
+
+		testCases := []struct {
+			rangeHeader          string
+			expectedStatus       int
+			expectedContentRange string
+			expectedBody         string
+		}{
+			{"bytes=1-", http.StatusPartialContent, "bytes 1-2/3", "bc"},
+			{"bytes=-1", http.StatusPartialContent, "bytes 2-2/3", "c"},
+			{"bytes=3-", http.StatusRequestedRangeNotSatisfiable, "bytes */3", "Range Not Satisfiable"},
+		}
+
+		for _, tc := range testCases {
+			resp, err := sendRequest(context.Background(), request{
+				method:  http.MethodGet,
+				url:     url,
+				headers: map[string][]string{"Range": {tc.rangeHeader}},
+			})
+			if err != nil {
+				tt.Fatalf("failed to send request: %v", err)
+			}
+
+			if resp.status != tc.expectedStatus {
+				tt.Errorf("unexpected status code for %v: got %v, want %v", tc.rangeHeader, resp.status, tc.expectedStatus)
+			}
+
+			if contentRange := resp.headers["Content-Range"]; len(contentRange) != 1 || contentRange[0] != tc.expectedContentRange {
+				tt.Errorf("unexpected Content-Range for %v: got %v, want %q", tc.rangeHeader, contentRange, tc.expectedContentRange)
+			}
+
+			if string(resp.body) != tc.expectedBody {
+				tt.Errorf("unexpected response body for %v: got %q, want %q", tc.rangeHeader, resp.body, tc.expectedBody)
+			}
+		}
+
+		resp, err := sendRequest(context.Background(), request{
+			method:  http.MethodGet,
+			url:     url,
+			headers: map[string][]string{"Range": {"bytes=0-0,2-2"}},
+		})
+		if err != nil {
+			tt.Fatalf("failed to send request: %v", err)
+		}
+
+		if resp.status != http.StatusPartialContent {
+			tt.Fatalf("unexpected status code: got %v, want %v", resp.status, http.StatusPartialContent)
+		}
+
+		contentType := strings.Join(resp.headers["Content-Type"], ",")
+		if !strings.HasPrefix(contentType, "multipart/byteranges; boundary=") {
+			tt.Errorf("unexpected Content-Type: got %q, want multipart/byteranges", contentType)
+		}
+
+		if !bytes.Contains(resp.body, []byte("Content-Range: bytes 2-2/3")) {
+			tt.Errorf("expected a part for bytes 2-2, got %q", resp.body)
+		}
+	})
+
+	t.Run("GET /files/test revalidation", func(tt *testing.T) {
+		url := fmt.Sprintf("http://localhost:%d/files/test", cfg.Port)
+
+		resp, err := sendRequest(context.Background(), request{method: http.MethodGet, url: url})
+		if err != nil {
+			tt.Fatalf("failed to send request: %v", err)
+		}
+
+		etag := resp.headers["Etag"]
+		lastModified := resp.headers["Last-Modified"]
+		if len(etag) != 1 || len(lastModified) != 1 {
+			tt.Fatalf("expected ETag and Last-Modified headers, got %v and %v", etag, lastModified)
+		}
+
+		testCases := []struct {
+			name           string
+			headers        map[string][]string
+			expectedStatus int
+		}{
+			{"If-None-Match", map[string][]string{"If-None-Match": etag}, http.StatusNotModified},
+			{"If-Modified-Since", map[string][]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+			{"If-Match", map[string][]string{"If-Match": {"\"stale\""}}, http.StatusPreconditionFailed},
+			{"If-Unmodified-Since", map[string][]string{"If-Unmodified-Since": {"Mon, 01 Jan 2001 00:00:00 GMT"}}, http.StatusPreconditionFailed},
+		}
+
+		for _, tc := range testCases {
+			resp, err := sendRequest(context.Background(), request{method: http.MethodGet, url: url, headers: tc.headers})
+			if err != nil {
+				tt.Fatalf("failed to send request: %v", err)
+			}
+
+			if resp.status != tc.expectedStatus {
+				tt.Errorf("unexpected status code for %v: got %v, want %v", tc.name, resp.status, tc.expectedStatus)
+			}
+		}
+	})
+
+	t.Run("GET /files content types", func(tt *testing.T) {
+		files := map[string]struct {
+			content             string
+			expectedContentType string
+		}{
+			"page.html":    {"<p>hello</p>", "text/html; charset=utf-8"},
+			"style.CSS":    {"p {}", "text/css; charset=utf-8"},
+			"todo.note":    {"buy milk", "text/x-note; charset=utf-8"},
+			"server.log":   {"started", "text/x-log; charset=utf-8"},
+			"image.bin":    {"\x89PNG\r\n\x1a\n", "image/png"},
+			"no-extension": {"plain text", "text/plain; charset=utf-8"},
+		}
+
+		for name, file := range files {
+			path := "./../testdata/" + name
+			err := os.WriteFile(path, []byte(file.content), 0o644)
+			if err != nil {
+				tt.Fatalf("failed to write file: %v", err)
+			}
+			defer os.Remove(path)
+
+			resp, err := sendRequest(context.Background(), request{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("http://localhost:%d/files/%v", cfg.Port, name),
+			})
+			if err != nil {
+				tt.Fatalf("failed to send request: %v", err)
+			}
+
+			if contentType := strings.Join(resp.headers["Content-Type"], ","); contentType != file.expectedContentType {
+				tt.Errorf("unexpected Content-Type for %v: got %q, want %q", name, contentType, file.expectedContentType)
+			}
+		}
+	})
+
+	t.Run("POST /files/new-file with gzip body", func(tt *testing.T) {
+		defer os.Remove("./../testdata/gzipped-file")
+
+		ctx := context.Background()
+		body := []byte("Hello, compressed World!")
+		url := fmt.Sprintf("http://localhost:%d/files/gzipped-file", cfg.Port)
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(body)
+		zw.Close()
+
+		resp1, err := sendRequest(ctx, request{
+			method:  http.MethodPost,
+			url:     url,
+			body:    &compressed,
+			headers: map[string][]string{"Content-Encoding": {"gzip"}},
+		})
+		if err != nil {
+			tt.Fatalf("failed to send request: %v", err)
+		}
+
+		if resp1.status != http.StatusCreated {
+			tt.Fatalf("unexpected status code: got %v, want %v", resp1.status, http.StatusCreated)
+		}
+
+		resp2, err := sendRequest(ctx, request{method: http.MethodGet, url: url})
+		if err != nil {
+			tt.Fatalf("failed to send request: %v", err)
+		}
+
+		if !bytes.Equal(resp2.body, body) {
+			tt.Fatalf("unexpected response body: got %q, want %q", resp2.body, body)
+		}
+	})
+
+	t.Run("POST /files/new-file with chunked body", func(tt *testing.T) {
+		filename := "hello-chunked"
+		filepath := fmt.Sprintf("./../testdata/%v", filename)
+		url := fmt.Sprintf("http://localhost:%d/files/%v", cfg.Port, filename)
+		body := "Hello, chunked World!"
+
+		// io.MultiReader hides the body length from the client, so it falls back to chunked encoding
+		req := request{
+			method: http.MethodPost,
+			url:    url,
+			body:   io.MultiReader(strings.NewReader(body)),
+		}
+		resp, err := sendRequest(context.Background(), req)
+		if err != nil {
+			tt.Fatalf("failed to send request: %v", err)
+		}
+		tt.Cleanup(func() {
+			os.Remove(filepath)
+		})
+
+		if resp.status != http.StatusCreated {
+			tt.Fatalf("unexpected status code: got %v, want %v", resp.status, http.StatusCreated)
+		}
+
+		content, err := os.ReadFile(filepath)
+		if err != nil {
+			tt.Fatalf("failed to read file: %v", err)
+		}
+
+		if string(content) != body {
+			tt.Fatalf("unexpected file content: got %q, want %q", content, body)
+		}
+	})
+
 	t.Run("Test re-use connection", func(tt *testing.T) {
 		// making sure that current connection is properly closed before running actual test
 		req := request{
@@ -239,6 +494,51 @@ func TestHandlers(t *testing.T) {
 		}
 	})
 
+	t.Run("files outside of the directory are forbidden", func(tt *testing.T) {
+		// a symlink inside the directory pointing outside of it
+		link := "./../testdata/escape-link"
+		os.Remove(link)
+		err := os.Symlink(os.TempDir(), link)
+		if err != nil {
+			tt.Fatalf("failed to create symlink: %v", err)
+		}
+		defer os.Remove(link)
+
+		for _, target := range []string{
+			"GET /files/../go.mod",
+			"GET /files/..%2F..%2Fetc%2Fpasswd",
+			"GET /files/sub/..%2F..%2Fgo.mod",
+			"GET /files/%2Fetc%2Fpasswd",
+			"GET /files/escape-link/file",
+			"POST /files/..%2Fescaped",
+			"POST /files/sub/../../escaped",
+			"POST /files/escape-link/escaped",
+		} {
+			conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", cfg.Port))
+			if err != nil {
+				tt.Fatalf("failed to connect: %v", err)
+			}
+
+			fmt.Fprintf(conn, "%s HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1\r\nConnection: close\r\n\r\nx", target)
+			raw, err := io.ReadAll(conn)
+			conn.Close()
+			if err != nil {
+				tt.Fatalf("failed to read response to %v: %v", target, err)
+			}
+
+			if !strings.HasPrefix(string(raw), "HTTP/1.1 403 Forbidden\r\n") {
+				tt.Errorf("expected 403 for %v, got %q", target, raw)
+			}
+		}
+
+		for _, path := range []string{"./../escaped", os.TempDir() + "/escaped"} {
+			_, err = os.Stat(path)
+			if !errors.Is(err, os.ErrNotExist) {
+				tt.Errorf("expected %v not to be created", path)
+			}
+		}
+	})
+
 	t.Run("Test gzip", func(tt *testing.T) {
 		str := "foobar123"
 		req := request{
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var (
+	errOutsideRoot = errors.New("path is outside of the files directory")
+)
+
+// fileRoot gives access to the files of a directory to request paths. Paths
+// that would escape the directory, either with ".." segments or by following
+// a symlink pointing outside of it, are refused with errOutsideRoot.
+type fileRoot struct {
+	root *os.Root
+	// escapeErr is the error os.Root returns for paths escaping it, which os
+	// doesn't export
+	escapeErr error
+}
+
+func openFileRoot(dir string) (*fileRoot, error) {
+	if dir == "" {
+		dir = "."
+	}
+
+	root, openErr := os.OpenRoot(dir)
+	if openErr != nil {
+		return nil, fmt.Errorf("cannot open files directory: %w", openErr)
+	}
+
+	// ".." escapes any root, so the error it gets is the one to look for
+	_, probeErr := root.Stat("..")
+	var pathErr *fs.PathError
+	if !errors.As(probeErr, &pathErr) {
+		root.Close()
+		return nil, fmt.Errorf("cannot open files directory: unexpected result of escaping it: %v", probeErr)
+	}
+
+	return &fileRoot{root: root, escapeErr: pathErr.Err}, nil
+}
+
+// Open opens the named file for reading. name is a slash-separated path
+// relative to the root.
+func (fr *fileRoot) Open(name string) (*os.File, error) {
+	path, pathErr := localPath(name)
+	if pathErr != nil {
+		return nil, pathErr
+	}
+
+	file, openErr := fr.root.Open(path)
+	if openErr != nil {
+		return nil, fr.rootError(openErr)
+	}
+
+	return file, nil
+}
+
+// Create creates or truncates the named file, creating the missing parent
+// directories.
+func (fr *fileRoot) Create(name string) (*os.File, error) {
+	path, pathErr := localPath(name)
+	if pathErr != nil {
+		return nil, pathErr
+	}
+
+	mkdirErr := fr.mkdirAll(filepath.Dir(path))
+	if mkdirErr != nil {
+		return nil, fr.rootError(mkdirErr)
+	}
+
+	file, createErr := fr.root.Create(path)
+	if createErr != nil {
+		return nil, fr.rootError(createErr)
+	}
+
+	return file, nil
+}
+
+func (fr *fileRoot) Close() error {
+	return fr.root.Close()
+}
+
+// mkdirAll creates dir and its missing parents inside the root.
+func (fr *fileRoot) mkdirAll(dir string) error {
+	if dir == "." {
+		return nil
+	}
+
+	parentErr := fr.mkdirAll(filepath.Dir(dir))
+	if parentErr != nil {
+		return parentErr
+	}
+
+	mkdirErr := fr.root.Mkdir(dir, 0o755)
+	if mkdirErr != nil && !errors.Is(mkdirErr, fs.ErrExist) {
+		return mkdirErr
+	}
+
+	return nil
+}
+
+// localPath converts a slash-separated request path to a path that is local
+// to the root, refusing absolute paths and paths with ".." segments.
+func localPath(name string) (string, error) {
+	path := filepath.FromSlash(name)
+	if !filepath.IsLocal(path) {
+		return "", errOutsideRoot
+	}
+
+	return path, nil
+}
+
+// rootError turns the error os.Root returns for a path escaping the root,
+// i.e. through a symlink, into errOutsideRoot.
+func (fr *fileRoot) rootError(err error) error {
+	if errors.Is(err, fr.escapeErr) {
+		return errOutsideRoot
+	}
+
+	return err
+}
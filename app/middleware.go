@@ -0,0 +1,23 @@
+package app
+
+import (
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func (a *App) logRequestMiddleware(next http.Handler) http.Handler {
+	return func(req *http.Request, resp *http.Response) {
+		start := time.Now()
+
+		next(req, resp)
+
+		a.Config.Logger.Info(
+			"request handled",
+			"method", req.Method,
+			"path", req.Path,
+			"status", resp.StatusCode,
+			"duration", time.Since(start),
+		)
+	}
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// readChunkedBody decodes a body sent with "Transfer-Encoding: chunked".
+//
+// chunked body format:
+//
+// 4;ext=value\r\n
+// Wiki\r\n
+// 5\r\n
+// pedia\r\n
+// 0\r\n
+// Trailer-Name: value\r\n
+// \r\n
+//
+// Chunk extensions are ignored. A body larger than maxSize bytes in total is
+// refused with errRequestBodyTooLarge.
+func readChunkedBody(r *bufio.Reader, maxSize int64) ([]byte, Header, error) {
+	var body bytes.Buffer
+
+	for {
+		line, readErr := readLine(r)
+		if readErr != nil {
+			return nil, nil, fmt.Errorf("cannot read chunk size: %w", noEOF(readErr))
+		}
+
+		sizeField, _, _ := bytes.Cut(line, []byte(";"))
+		size, parseErr := strconv.ParseInt(string(bytes.TrimSpace(sizeField)), 16, 64)
+		if parseErr != nil || size < 0 {
+			return nil, nil, fmt.Errorf("invalid chunk size: %q", line)
+		}
+
+		if size == 0 {
+			break // Last chunk
+		}
+
+		if size > maxSize-int64(body.Len()) {
+			return nil, nil, errRequestBodyTooLarge
+		}
+
+		// the buffer grows as the chunk arrives rather than trusting its size
+		_, readErr = io.CopyN(&body, r, size)
+		if readErr != nil {
+			return nil, nil, fmt.Errorf("cannot read chunk data: %w", noEOF(readErr))
+		}
+
+		// every chunk data is followed by \r\n
+		line, readErr = readLine(r)
+		if readErr != nil {
+			return nil, nil, fmt.Errorf("cannot read end of chunk: %w", noEOF(readErr))
+		}
+		if len(line) != 0 {
+			return nil, nil, fmt.Errorf("invalid end of chunk: %q", line)
+		}
+	}
+
+	trailers, trailersErr := readHeaders(r)
+	if trailersErr != nil {
+		return nil, nil, fmt.Errorf("cannot read trailers: %w", trailersErr)
+	}
+
+	return body.Bytes(), trailers, nil
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF since the body is not complete yet.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,125 @@
+package http_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestReadChunkedRequest(t *testing.T) {
+	var testCases = []struct {
+		description      string
+		rawRequest       string
+		expectedBody     string
+		expectedTrailers map[string]string
+	}{
+		{
+			description: "body with multiple chunks",
+			rawRequest: "POST /files/foo HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"4\r\nWiki\r\n5\r\npedia\r\n0\r\n\r\n",
+			expectedBody:     "Wikipedia",
+			expectedTrailers: map[string]string{},
+		},
+		{
+			description: "chunk sizes in upper case hex with extensions",
+			rawRequest: "POST /files/foo HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"A;name=value\r\n0123456789\r\n0;last\r\n\r\n",
+			expectedBody:     "0123456789",
+			expectedTrailers: map[string]string{},
+		},
+		{
+			description: "body with trailers",
+			rawRequest: "POST /files/foo HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTrailer: Checksum\r\n\r\n" +
+				"3\r\nfoo\r\n0\r\nChecksum: abc\r\n\r\n",
+			expectedBody:     "foo",
+			expectedTrailers: map[string]string{"Checksum": "abc"},
+		},
+		{
+			description: "empty body",
+			rawRequest: "POST /files/foo HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"0\r\n\r\n",
+			expectedBody:     "",
+			expectedTrailers: map[string]string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req, err := http.ParseRequest([]byte(tc.rawRequest))
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+
+			if string(req.Body) != tc.expectedBody {
+				t.Errorf("expected body %q but got %q", tc.expectedBody, req.Body)
+			}
+
+			if len(req.Trailers) != len(tc.expectedTrailers) {
+				t.Errorf("expected %v trailers but got %v", len(tc.expectedTrailers), len(req.Trailers))
+			}
+
+			for name, value := range tc.expectedTrailers {
+				if req.Trailers.Get(name) != value {
+					t.Errorf("expected %v trailer to have value %v but got %v", name, value, req.Trailers.Get(name))
+				}
+			}
+		})
+	}
+
+	t.Run("leaves the next pipelined request in the reader", func(t *testing.T) {
+		raw := "POST /a HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nfoo\r\n0\r\n\r\n" +
+			"GET /b HTTP/1.1\r\n\r\n"
+		reader := bufio.NewReader(strings.NewReader(raw))
+
+		_, err := http.ReadRequest(reader)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if req.Path != "/b" {
+			t.Errorf("expected /b path but got %v", req.Path)
+		}
+	})
+
+	t.Run("returns error on truncated chunk", func(t *testing.T) {
+		raw := "POST /a HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n10\r\nfoo"
+		_, err := http.ParseRequest([]byte(raw))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected io.ErrUnexpectedEOF but got %v", err)
+		}
+	})
+
+	t.Run("refuses chunk larger than the body limit", func(t *testing.T) {
+		raw := "POST /a HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nfffffffff\r\nfoo"
+		_, err := http.ParseRequest([]byte(raw))
+		expectedMsg := "cannot read chunked request body: request body is too large"
+		if err == nil || err.Error() != expectedMsg {
+			t.Errorf("expected %q error but got %v", expectedMsg, err)
+		}
+	})
+
+	t.Run("returns error on invalid chunk size", func(t *testing.T) {
+		raw := "POST /a HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\nfoo\r\n0\r\n\r\n"
+		_, err := http.ParseRequest([]byte(raw))
+		if err == nil {
+			t.Errorf("expected error but got nil")
+		}
+	})
+
+	t.Run("rejects both Transfer-Encoding and Content-Length", func(t *testing.T) {
+		raw := "POST /a HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n0\r\n\r\n"
+		_, err := http.ParseRequest([]byte(raw))
+		expectedMsg := "request has both Transfer-Encoding and Content-Length headers"
+		if err == nil || err.Error() != expectedMsg {
+			t.Errorf("expected %q error but got %v", expectedMsg, err)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultCompressMinSize is the body size below which compressing is
+	// usually not worth it.
+	DefaultCompressMinSize = 1024
+)
+
+var (
+	// supported content codings in order of preference
+	encodings = []string{"gzip", "deflate"}
+
+	// content types that are compressed already
+	compressedTypes = map[string]bool{
+		"application/gzip":             true,
+		"application/x-gzip":           true,
+		"application/zip":              true,
+		"application/x-rar-compressed": true,
+		"application/x-7z-compressed":  true,
+		"application/x-bzip2":          true,
+		"application/x-xz":             true,
+		"application/zstd":             true,
+		"application/ogg":              true,
+		"font/woff":                    true,
+		"font/woff2":                   true,
+	}
+)
+
+// Compress returns a middleware compressing response bodies with gzip or
+// deflate, depending on the Accept-Encoding header of the request. Bodies
+// are compressed while they are streamed.
+//
+// Bodies smaller than minSize, bodies with a Content-Encoding set by the
+// handler and content types that are compressed already (images, audio,
+// video and archives) are sent as they are, unless the client refuses the
+// identity encoding. Partial content responses are never compressed. The
+// ETag of a compressed body is made weak, since its bytes differ from the
+// ones the handler tagged. When routes and the mux both use Compress, the one
+// closest to the handler applies.
+func Compress(minSize int) Middleware {
+	return func(next Handler) Handler {
+		return func(req *Request, resp *Response) {
+			encoding, identityAllowed := negotiateEncoding(req.Headers.Values("Accept-Encoding"))
+
+			resp.encode = func(w io.Writer, complete bool) bodyEncoder {
+				// the body depends on Accept-Encoding even when it is not encoded
+				vary := strings.ToLower(strings.Join(resp.Headers.Values("Vary"), ","))
+				if !strings.Contains(vary, "accept-encoding") {
+					resp.Headers.Add("Vary", "Accept-Encoding")
+				}
+
+				if encoding == "" || resp.Headers.Has("Content-Encoding") {
+					return nil
+				}
+
+				// byte ranges refer to the unencoded body
+				if resp.StatusCode == StatusPartialContent || resp.Headers.Has("Content-Range") {
+					return nil
+				}
+
+				if complete && len(resp.Body) == 0 {
+					return nil
+				}
+
+				if identityAllowed {
+					size := -1
+					if complete {
+						size = len(resp.Body)
+					} else if resp.Headers.Has("Content-Length") {
+						size, _ = strconv.Atoi(resp.Headers.Get("Content-Length"))
+					}
+
+					if size >= 0 && size < minSize {
+						return nil
+					}
+
+					if !compressible(resp.Headers.Get("Content-Type")) {
+						return nil
+					}
+				}
+
+				resp.Headers.Set("Content-Encoding", encoding)
+				resp.Headers.Del("Content-Length")
+				resp.Headers.Del("Accept-Ranges")
+				if etag := resp.Headers.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+					resp.Headers.Set("ETag", "W/"+etag)
+				}
+
+				return newEncoder(encoding, w)
+			}
+
+			next(req, resp)
+		}
+	}
+}
+
+// negotiateEncoding picks the supported content coding the client prefers
+// from the values of its Accept-Encoding headers, i.e. "gzip;q=0.8, br". It
+// returns an empty string when the body should not be encoded, and whether
+// the client accepts unencoded bodies.
+func negotiateEncoding(values []string) (string, bool) {
+	qvalues := make(map[string]float64)
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			coding, q, ok := parseQValue(element)
+			if ok {
+				qvalues[coding] = q
+			}
+		}
+	}
+
+	acceptance := func(coding string) float64 {
+		q, exists := qvalues[coding]
+		if exists {
+			return q
+		}
+
+		q, exists = qvalues["*"]
+		if exists {
+			return q
+		}
+
+		// identity is acceptable unless refused explicitly
+		if coding == "identity" {
+			return 1
+		}
+		return 0
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range encodings {
+		q := acceptance(coding)
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best, acceptance("identity") > 0
+}
+
+// parseQValue parses an element of an Accept-Encoding header, i.e.
+// "gzip;q=0.5". ok is false for empty or malformed elements.
+func parseQValue(element string) (coding string, q float64, ok bool) {
+	coding, params, _ := strings.Cut(element, ";")
+	coding = strings.ToLower(strings.TrimSpace(coding))
+	if coding == "" {
+		return "", 0, false
+	}
+	if coding == "x-gzip" {
+		coding = "gzip"
+	}
+
+	q = 1
+	for _, param := range strings.Split(params, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+
+		parsed, parseErr := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if parseErr != nil || parsed < 0 || parsed > 1 {
+			return "", 0, false
+		}
+		q = parsed
+	}
+
+	return coding, q, true
+}
+
+// compressible tells whether compressing a body of the content type is worth
+// it.
+func compressible(contentType string) bool {
+	mediaType, _, parseErr := mime.ParseMediaType(contentType)
+	if parseErr != nil {
+		return true
+	}
+
+	if compressedTypes[mediaType] {
+		return false
+	}
+
+	kind, _, _ := strings.Cut(mediaType, "/")
+	switch kind {
+	case "image":
+		return mediaType == "image/svg+xml" || mediaType == "image/bmp"
+	case "audio", "video":
+		return false
+	}
+
+	return true
+}
+
+func newEncoder(encoding string, w io.Writer) bodyEncoder {
+	switch encoding {
+	case "deflate":
+		// the deflate content coding is the zlib format rather than raw deflate
+		return zlib.NewWriter(w)
+	default:
+		return gzip.NewWriter(w)
+	}
+}
@@ -0,0 +1,255 @@
+package http_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	var testCases = []struct {
+		acceptEncoding  []string
+		expected        string
+		identityAllowed bool
+	}{
+		{acceptEncoding: nil, expected: "", identityAllowed: true},
+		{acceptEncoding: []string{"gzip"}, expected: "gzip", identityAllowed: true},
+		{acceptEncoding: []string{"deflate, gzip"}, expected: "gzip", identityAllowed: true},
+		{acceptEncoding: []string{"gzip;q=0.5, deflate"}, expected: "deflate", identityAllowed: true},
+		{acceptEncoding: []string{"gzip;q=0", "deflate;q=0.1"}, expected: "deflate", identityAllowed: true},
+		{acceptEncoding: []string{"br"}, expected: "", identityAllowed: true},
+		{acceptEncoding: []string{"*"}, expected: "gzip", identityAllowed: true},
+		{acceptEncoding: []string{"*;q=0.5, gzip;q=0"}, expected: "deflate", identityAllowed: true},
+		{acceptEncoding: []string{"gzip, identity;q=0"}, expected: "gzip", identityAllowed: false},
+		{acceptEncoding: []string{"*;q=0"}, expected: "", identityAllowed: false},
+		{acceptEncoding: []string{"X-GZIP; Q=0.8"}, expected: "gzip", identityAllowed: true},
+		{acceptEncoding: []string{"gzip;q=2, deflate"}, expected: "deflate", identityAllowed: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.acceptEncoding, " | "), func(t *testing.T) {
+			encoding, identityAllowed := http.NegotiateEncoding(tc.acceptEncoding)
+			if encoding != tc.expected {
+				t.Errorf("expected encoding %q, got %q", tc.expected, encoding)
+			}
+
+			if identityAllowed != tc.identityAllowed {
+				t.Errorf("expected identity allowed to be %v, got %v", tc.identityAllowed, identityAllowed)
+			}
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	text := strings.Repeat("compressible text ", 100)
+
+	// serve runs handler behind the compression middleware and returns the
+	// raw response parsed by net/http.
+	serve := func(t *testing.T, acceptEncoding string, handler http.Handler) *nethttp.Response {
+		t.Helper()
+
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		req := &http.Request{Method: "GET", Path: "/"}
+		if acceptEncoding != "" {
+			req.Headers.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp := http.NewConnResponse(w)
+		http.Compress(http.DefaultCompressMinSize)(handler)(req, resp)
+
+		err := resp.Finish()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		parsed, err := nethttp.ReadResponse(bufio.NewReader(&buf), nil)
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+
+		return parsed
+	}
+
+	decode := func(t *testing.T, resp *nethttp.Response) string {
+		t.Helper()
+
+		var reader io.Reader = resp.Body
+		var err error
+		switch resp.Header.Get("Content-Encoding") {
+		case "gzip":
+			reader, err = gzip.NewReader(resp.Body)
+		case "deflate":
+			reader, err = zlib.NewReader(resp.Body)
+		}
+		if err != nil {
+			t.Fatalf("failed to create decoder: %v", err)
+		}
+
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+
+		return string(body)
+	}
+
+	bodyHandler := func(contentType, body string) http.Handler {
+		return func(req *http.Request, resp *http.Response) {
+			if contentType != "" {
+				resp.Headers.Set("Content-Type", contentType)
+			}
+			resp.Body = []byte(body)
+		}
+	}
+
+	var testCases = []struct {
+		description      string
+		acceptEncoding   string
+		handler          http.Handler
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{
+			description:      "gzip",
+			acceptEncoding:   "gzip",
+			handler:          bodyHandler("", text),
+			expectedEncoding: "gzip",
+			expectedBody:     text,
+		},
+		{
+			description:      "deflate",
+			acceptEncoding:   "deflate",
+			handler:          bodyHandler("", text),
+			expectedEncoding: "deflate",
+			expectedBody:     text,
+		},
+		{
+			description:  "no Accept-Encoding",
+			handler:      bodyHandler("", text),
+			expectedBody: text,
+		},
+		{
+			description:    "tiny body",
+			acceptEncoding: "gzip",
+			handler:        bodyHandler("", "tiny"),
+			expectedBody:   "tiny",
+		},
+		{
+			description:      "tiny body when identity is refused",
+			acceptEncoding:   "gzip, identity;q=0",
+			handler:          bodyHandler("", "tiny"),
+			expectedEncoding: "gzip",
+			expectedBody:     "tiny",
+		},
+		{
+			description:    "compressed content type",
+			acceptEncoding: "gzip",
+			handler:        bodyHandler("image/png", text),
+			expectedBody:   text,
+		},
+		{
+			description:      "SVG is compressed",
+			acceptEncoding:   "gzip",
+			handler:          bodyHandler("image/svg+xml", text),
+			expectedEncoding: "gzip",
+			expectedBody:     text,
+		},
+		{
+			description:    "partial content",
+			acceptEncoding: "gzip",
+			expectedBody:   text[:1500],
+			handler: func(req *http.Request, resp *http.Response) {
+				resp.StatusCode = http.StatusPartialContent
+				resp.Headers.Set("Content-Range", fmt.Sprintf("bytes 0-1499/%d", len(text)))
+				resp.Body = []byte(text[:1500])
+			},
+		},
+		{
+			description:      "streamed body",
+			acceptEncoding:   "gzip",
+			expectedEncoding: "gzip",
+			expectedBody:     text + text,
+			handler: func(req *http.Request, resp *http.Response) {
+				resp.Write([]byte(text))
+				resp.Flush()
+				resp.Write([]byte(text))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			resp := serve(t, tc.acceptEncoding, tc.handler)
+
+			if resp.Header.Get("Content-Encoding") != tc.expectedEncoding {
+				t.Errorf("expected Content-Encoding %q, got %q", tc.expectedEncoding, resp.Header.Get("Content-Encoding"))
+			}
+
+			if resp.Header.Get("Vary") != "Accept-Encoding" {
+				t.Errorf("expected Vary header \"Accept-Encoding\", got %q", resp.Header.Get("Vary"))
+			}
+
+			body := decode(t, resp)
+			if body != tc.expectedBody {
+				t.Errorf("expected body of %d bytes, got %q", len(tc.expectedBody), body)
+			}
+		})
+	}
+
+	t.Run("complete body is sent with Content-Length", func(t *testing.T) {
+		resp := serve(t, "gzip", bodyHandler("", text))
+
+		if resp.ContentLength <= 0 || resp.ContentLength >= int64(len(text)) {
+			t.Errorf("expected Content-Length of the compressed body, got %d", resp.ContentLength)
+		}
+
+		if resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("expected Content-Type of the uncompressed body, got %q", resp.Header.Get("Content-Type"))
+		}
+	})
+
+	t.Run("entity tag of a compressed body is weak", func(t *testing.T) {
+		var testCases = []struct {
+			acceptEncoding string
+			etag           string
+			expectedETag   string
+		}{
+			{acceptEncoding: "gzip", etag: "\"v1\"", expectedETag: "W/\"v1\""},
+			{acceptEncoding: "gzip", etag: "W/\"v1\"", expectedETag: "W/\"v1\""},
+			{acceptEncoding: "", etag: "\"v1\"", expectedETag: "\"v1\""},
+		}
+
+		for _, tc := range testCases {
+			resp := serve(t, tc.acceptEncoding, func(req *http.Request, resp *http.Response) {
+				resp.Headers.Set("ETag", tc.etag)
+				resp.Body = []byte(text)
+			})
+
+			if etag := resp.Header.Get("ETag"); etag != tc.expectedETag {
+				t.Errorf("expected ETag %q for Accept-Encoding %q, got %q", tc.expectedETag, tc.acceptEncoding, etag)
+			}
+		}
+	})
+
+	t.Run("streamed body is chunked", func(t *testing.T) {
+		resp := serve(t, "gzip", func(req *http.Request, resp *http.Response) {
+			resp.Headers.Set("Content-Length", strconv.Itoa(len(text)))
+			resp.Write([]byte(text))
+			resp.Flush()
+		})
+
+		if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+			t.Errorf("expected chunked response, got %v", resp.TransferEncoding)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FileETag returns an entity tag for content of size bytes last modified at
+// modTime, i.e. a file. The tag is weak when the content was modified less
+// than a second ago since it may still be changing without its modification
+// time or size telling.
+func FileETag(size int64, modTime time.Time) string {
+	etag := fmt.Sprintf("\"%x-%x\"", modTime.UnixNano(), size)
+	if time.Since(modTime) < time.Second {
+		return "W/" + etag
+	}
+
+	return etag
+}
+
+// checkPreconditions evaluates the conditional headers of a request against
+// the ETag header of the response and modTime, in the order of RFC 9110
+// section 13.2.2. It returns StatusNotModified or StatusPreconditionFailed
+// when the request should be answered with them, and 0 otherwise.
+func checkPreconditions(req *Request, resp *Response, modTime time.Time) int {
+	etag := resp.Headers.Get("ETag")
+
+	if req.Headers.Has("If-Match") {
+		if !etagListMatches(req.Headers.Values("If-Match"), etag, true) {
+			return StatusPreconditionFailed
+		}
+	} else if date, ok := conditionDate(req, "If-Unmodified-Since", modTime); ok && modifiedSince(modTime, date) {
+		return StatusPreconditionFailed
+	}
+
+	safe := req.Method == "GET" || req.Method == "HEAD"
+	if req.Headers.Has("If-None-Match") {
+		if etagListMatches(req.Headers.Values("If-None-Match"), etag, false) {
+			if safe {
+				return StatusNotModified
+			}
+			return StatusPreconditionFailed
+		}
+	} else if date, ok := conditionDate(req, "If-Modified-Since", modTime); ok && safe && !modifiedSince(modTime, date) {
+		return StatusNotModified
+	}
+
+	return 0
+}
+
+// conditionDate parses the date of a conditional header. ok is false when
+// the header is missing or invalid, or when there is no modification time
+// to compare it with, in which case the header is ignored.
+func conditionDate(req *Request, name string, modTime time.Time) (date time.Time, ok bool) {
+	value := req.Headers.Get(name)
+	if value == "" || modTime.IsZero() {
+		return time.Time{}, false
+	}
+
+	date, parseErr := time.Parse(TimeFormat, value)
+	if parseErr != nil {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
+
+// modifiedSince tells whether modTime is after date. Dates sent in headers
+// have a one second precision.
+func modifiedSince(modTime time.Time, date time.Time) bool {
+	return modTime.Truncate(time.Second).After(date)
+}
+
+// etagListMatches tells whether etag is in the lists of entity tags of
+// If-Match or If-None-Match header values, or whether they hold "*". The
+// strong comparison never matches weak tags, the weak one ignores the W/
+// prefix. "*" matches any existing content, even without an entity tag.
+func etagListMatches(values []string, etag string, strong bool) bool {
+	for _, value := range values {
+		list := strings.TrimSpace(value)
+		if list == "*" {
+			return true
+		}
+
+		for list != "" && etag != "" {
+			tag, rest, ok := scanETag(list)
+			if !ok {
+				break
+			}
+
+			if etagsMatch(tag, etag, strong) {
+				return true
+			}
+			list = strings.TrimLeft(rest, ", \t")
+		}
+	}
+
+	return false
+}
+
+func etagsMatch(a, b string, strong bool) bool {
+	if strong {
+		return !strings.HasPrefix(a, "W/") && a == b
+	}
+
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// scanETag reads the entity tag at the start of s, i.e. `"xyz"` or
+// `W/"xyz"`, and returns it with the rest of s.
+func scanETag(s string) (etag string, rest string, ok bool) {
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+
+	if len(s) < start+2 || s[start] != '"' {
+		return "", "", false
+	}
+
+	end := strings.IndexByte(s[start+1:], '"')
+	if end < 0 {
+		return "", "", false
+	}
+	end += start + 2
+
+	return s[:end], s[end:], true
+}
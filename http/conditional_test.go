@@ -0,0 +1,245 @@
+package http_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestFileETag(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	etag := http.FileETag(10, modTime)
+	if !strings.HasPrefix(etag, "\"") || !strings.HasSuffix(etag, "\"") {
+		t.Errorf("expected a strong entity tag, got %v", etag)
+	}
+
+	if other := http.FileETag(11, modTime); other == etag {
+		t.Errorf("expected entity tags of different sizes to differ, got %v twice", etag)
+	}
+
+	if other := http.FileETag(10, modTime.Add(time.Nanosecond)); other == etag {
+		t.Errorf("expected entity tags of different modification times to differ, got %v twice", etag)
+	}
+
+	if recent := http.FileETag(10, time.Now()); !strings.HasPrefix(recent, "W/\"") {
+		t.Errorf("expected a weak entity tag for content modified just now, got %v", recent)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	content := "0123456789"
+	etag := "\"v1\""
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	lastModified := "Wed, 01 May 2024 12:00:00 GMT"
+	before := "Tue, 30 Apr 2024 12:00:00 GMT"
+	after := "Thu, 02 May 2024 12:00:00 GMT"
+
+	var testCases = []struct {
+		description    string
+		method         string
+		etag           string
+		headers        map[string]string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description:    "If-None-Match with the entity tag",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"If-None-Match": etag},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			description:    "If-None-Match in a list",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"If-None-Match": "\"v0\", \"v,1\" ,W/\"v1\""},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			description:    "If-None-Match with a weak tag",
+			method:         "HEAD",
+			etag:           "W/\"v1\"",
+			headers:        map[string]string{"If-None-Match": etag},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			description:    "If-None-Match with another tag",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"If-None-Match": "\"v0\""},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-None-Match any",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"If-None-Match": "*"},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			description:    "If-None-Match of a POST request",
+			method:         "POST",
+			etag:           etag,
+			headers:        map[string]string{"If-None-Match": etag},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedBody:   "Precondition Failed",
+		},
+		{
+			description:    "If-Modified-Since the modification date",
+			method:         "GET",
+			headers:        map[string]string{"If-Modified-Since": lastModified},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			description:    "If-Modified-Since an earlier date",
+			method:         "GET",
+			headers:        map[string]string{"If-Modified-Since": before},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-Modified-Since an invalid date",
+			method:         "GET",
+			headers:        map[string]string{"If-Modified-Since": "yesterday"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-None-Match takes precedence over If-Modified-Since",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"If-None-Match": "\"v0\"", "If-Modified-Since": lastModified},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-Match with the entity tag",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"If-Match": etag},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-Match with another tag",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"If-Match": "\"v0\""},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedBody:   "Precondition Failed",
+		},
+		{
+			description:    "If-Match with a weak tag",
+			method:         "GET",
+			etag:           "W/\"v1\"",
+			headers:        map[string]string{"If-Match": "W/\"v1\""},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedBody:   "Precondition Failed",
+		},
+		{
+			description:    "If-Match any without an entity tag",
+			method:         "GET",
+			headers:        map[string]string{"If-Match": "*"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-Match without an entity tag",
+			method:         "GET",
+			headers:        map[string]string{"If-Match": "\"v1\""},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedBody:   "Precondition Failed",
+		},
+		{
+			description:    "If-None-Match any without an entity tag",
+			method:         "GET",
+			headers:        map[string]string{"If-None-Match": "*"},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			description:    "If-Unmodified-Since a later date",
+			method:         "GET",
+			headers:        map[string]string{"If-Unmodified-Since": after},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-Unmodified-Since an earlier date",
+			method:         "GET",
+			headers:        map[string]string{"If-Unmodified-Since": before},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedBody:   "Precondition Failed",
+		},
+		{
+			description:    "If-Match takes precedence over If-Unmodified-Since",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"If-Match": etag, "If-Unmodified-Since": before},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-Range with the entity tag",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"Range": "bytes=0-1", "If-Range": etag},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   "01",
+		},
+		{
+			description:    "If-Range with another tag",
+			method:         "GET",
+			etag:           etag,
+			headers:        map[string]string{"Range": "bytes=0-1", "If-Range": "\"v0\""},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-Range with a weak tag",
+			method:         "GET",
+			etag:           "W/\"v1\"",
+			headers:        map[string]string{"Range": "bytes=0-1", "If-Range": "W/\"v1\""},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := &http.Request{Method: tc.method, Path: "/"}
+			for name, value := range tc.headers {
+				req.Headers.Set(name, value)
+			}
+
+			resp := http.NewResponse()
+			if tc.etag != "" {
+				resp.Headers.Set("ETag", tc.etag)
+			}
+			err := http.ServeContent(req, resp, strings.NewReader(content), int64(len(content)), modTime)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if body := readBody(t, resp); body != tc.expectedBody {
+				t.Errorf("expected body %q, got %q", tc.expectedBody, body)
+			}
+
+			if resp.Headers.Get("ETag") != tc.etag {
+				t.Errorf("expected ETag %q, got %q", tc.etag, resp.Headers.Get("ETag"))
+			}
+
+			if modified := resp.Headers.Get("Last-Modified"); modified != lastModified {
+				t.Errorf("expected Last-Modified %q, got %q", lastModified, modified)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package http
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeContent responds with content of size bytes, i.e. a file, honouring
+// Range and conditional headers. modTime is sent as Last-Modified unless it
+// is zero, and the ETag header set by the handler, if any, is what
+// If-Match, If-None-Match and If-Range are compared with (see FileETag).
+//
+// Requests whose preconditions fail are answered with 304 Not Modified for
+// GET and HEAD, i.e. when the client already has the content, and with 412
+// Precondition Failed otherwise.
+//
+// A Range header asking for a single range is answered with 206 and that
+// range, one asking for several with 206 and a multipart/byteranges body,
+// and one asking only for ranges past the end of the content with 416.
+//
+// The Content-Type set by the handler is kept; otherwise it is detected from
+// the first bytes of content.
+//
+// The body is set as the BodyReader of the response: content is only read
+// once the handler returns, and only the requested spans of it. Content that
+// is also an io.ReadSeeker, such as an *os.File, is read from with its own
+// offset so that it can be sent with sendfile. ServeContent closes content if
+// it is an io.Closer, once the response is sent.
+func ServeContent(req *Request, resp *Response, content io.ReaderAt, size int64, modTime time.Time) error {
+	body, serveErr := serveContent(req, resp, content, size, modTime)
+	if serveErr != nil || body == nil {
+		closeContent(content)
+		return serveErr
+	}
+
+	resp.BodyReader = &contentBody{Reader: body, content: content}
+
+	return nil
+}
+
+// serveContent sets the status and headers of the response, and returns the
+// reader of its body, if it has one made of content.
+func serveContent(req *Request, resp *Response, content io.ReaderAt, size int64, modTime time.Time) (io.Reader, error) {
+	if !modTime.IsZero() {
+		resp.Headers.Set("Last-Modified", modTime.UTC().Format(TimeFormat))
+	}
+	resp.Headers.Set("Accept-Ranges", "bytes")
+
+	switch status := checkPreconditions(req, resp, modTime); status {
+	case StatusNotModified:
+		resp.StatusCode = status
+		resp.Headers.Del("Content-Type")
+		return nil, nil
+
+	case StatusPreconditionFailed:
+		resp.StatusCode = status
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Body = []byte(StatusText(status))
+		return nil, nil
+	}
+
+	if !resp.Headers.Has("Content-Type") {
+		head := make([]byte, min(size, sniffLen))
+		_, readErr := content.ReadAt(head, 0)
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, fmt.Errorf("cannot read content: %w", readErr)
+		}
+		resp.Headers.Set("Content-Type", DetectContentType(head))
+	}
+
+	var ranges []ByteRange
+	if req.Method == "GET" && req.Headers.Has("Range") && ifRangeMatches(req, resp, modTime) {
+		var rangeErr error
+		ranges, rangeErr = ParseRange(req.Headers.Get("Range"), size)
+		if errors.Is(rangeErr, ErrRangeNotSatisfiable) {
+			resp.StatusCode = StatusRangeNotSatisfiable
+			resp.Headers.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			resp.Headers.Set("Content-Type", "text/plain")
+			resp.Body = []byte(StatusText(StatusRangeNotSatisfiable))
+			return nil, nil
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		resp.StatusCode = StatusOK
+		resp.Headers.Set("Content-Length", strconv.FormatInt(size, 10))
+		return newSpanReader(content, ByteRange{Start: 0, Length: size}), nil
+
+	case 1:
+		resp.StatusCode = StatusPartialContent
+		resp.Headers.Set("Content-Range", ranges[0].ContentRange(size))
+		resp.Headers.Set("Content-Length", strconv.FormatInt(ranges[0].Length, 10))
+		return newSpanReader(content, ranges[0]), nil
+
+	default:
+		resp.StatusCode = StatusPartialContent
+		return multipartBody(resp, content, size, ranges)
+	}
+}
+
+// ifRangeMatches tells whether the ranges of a request apply. A request
+// without If-Range always gets them. Otherwise the content must still have
+// the strong entity tag or the modification date If-Range holds.
+func ifRangeMatches(req *Request, resp *Response, modTime time.Time) bool {
+	ifRange := req.Headers.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return etagsMatch(ifRange, resp.Headers.Get("ETag"), true)
+	}
+
+	date, parseErr := time.Parse(TimeFormat, ifRange)
+	if parseErr != nil || modTime.IsZero() {
+		return false
+	}
+
+	// Last-Modified has a one second precision
+	return modTime.Truncate(time.Second).Equal(date)
+}
+
+// multipartBody returns a multipart/byteranges body with a part per range,
+// and sets its Content-Type and Content-Length.
+func multipartBody(resp *Response, content io.ReaderAt, size int64, ranges []ByteRange) (io.Reader, error) {
+	boundary, boundaryErr := randomBoundary()
+	if boundaryErr != nil {
+		return nil, boundaryErr
+	}
+
+	// the multipart writer is only used for the delimiters and part headers,
+	// which are read in turn with the spans of content
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.SetBoundary(boundary)
+
+	var readers []io.Reader
+	var length int64
+	contentType := resp.Headers.Get("Content-Type")
+	for _, r := range ranges {
+		_, partErr := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {r.ContentRange(size)},
+		})
+		if partErr != nil {
+			return nil, partErr
+		}
+
+		readers = append(readers, bytes.NewReader(bytes.Clone(buf.Bytes())), newSpanReader(content, r))
+		length += int64(buf.Len()) + r.Length
+		buf.Reset()
+	}
+	mw.Close()
+	readers = append(readers, bytes.NewReader(bytes.Clone(buf.Bytes())))
+	length += int64(buf.Len())
+
+	resp.Headers.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	resp.Headers.Set("Content-Length", strconv.FormatInt(length, 10))
+
+	return io.MultiReader(readers...), nil
+}
+
+func randomBoundary() (string, error) {
+	var buf [16]byte
+	_, readErr := rand.Read(buf[:])
+	if readErr != nil {
+		return "", fmt.Errorf("cannot generate multipart boundary: %w", readErr)
+	}
+
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// spanReader reads a span of content. When content is an io.ReadSeeker, i.e.
+// a file, WriteTo seeks to the span and copies from content itself rather
+// than with ReadAt, so that a file can be sent with sendfile.
+type spanReader struct {
+	*io.SectionReader
+	content io.ReaderAt
+	start   int64
+}
+
+func newSpanReader(content io.ReaderAt, span ByteRange) *spanReader {
+	return &spanReader{
+		SectionReader: io.NewSectionReader(content, span.Start, span.Length),
+		content:       content,
+		start:         span.Start,
+	}
+}
+
+func (sr *spanReader) WriteTo(w io.Writer) (int64, error) {
+	seeker, ok := sr.content.(io.ReadSeeker)
+	if !ok {
+		return io.Copy(w, sr.SectionReader)
+	}
+
+	offset, _ := sr.Seek(0, io.SeekCurrent)
+	_, seekErr := seeker.Seek(sr.start+offset, io.SeekStart)
+	if seekErr != nil {
+		return 0, fmt.Errorf("cannot read content: %w", seekErr)
+	}
+
+	n, copyErr := io.Copy(w, io.LimitReader(seeker, sr.Size()-offset))
+	sr.Seek(offset+n, io.SeekStart)
+
+	return n, copyErr
+}
+
+// contentBody is the body set by ServeContent. It closes content once the
+// response is sent.
+type contentBody struct {
+	io.Reader
+	content io.ReaderAt
+}
+
+// WriteTo lets the reader of the body copy itself, i.e. with sendfile.
+func (b *contentBody) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, b.Reader)
+}
+
+func (b *contentBody) Close() error {
+	return closeContent(b.content)
+}
+
+func closeContent(content io.ReaderAt) error {
+	closer, ok := content.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	return closer.Close()
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TimeFormat is the format of dates in HTTP headers, i.e. Date and
+// Last-Modified. Times must be in UTC.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// cachedDate is the Date header value for a second, so that it is formatted
+// once per second rather than once per response.
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+var currentDate atomic.Pointer[cachedDate]
+
+// httpDate returns the current time formatted for the Date header.
+func httpDate() string {
+	now := time.Now()
+
+	cached := currentDate.Load()
+	if cached != nil && cached.unix == now.Unix() {
+		return cached.value
+	}
+
+	cached = &cachedDate{
+		unix:  now.Unix(),
+		value: now.UTC().Format(TimeFormat),
+	}
+	currentDate.Store(cached)
+
+	return cached.value
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	errBodyTooLarge = errors.New("decompressed body is too large")
+)
+
+// DecompressBody returns a middleware decoding request bodies sent with a
+// gzip or deflate Content-Encoding, so that handlers see the original body.
+// A body that decompresses to more than maxSize bytes is refused with 413,
+// an undecodable body with 400 and an unsupported encoding with 415.
+func DecompressBody(maxSize int64) Middleware {
+	return func(next Handler) Handler {
+		return func(req *Request, resp *Response) {
+			codings := contentCodings(req.Headers.Values("Content-Encoding"))
+			if len(codings) == 0 {
+				next(req, resp)
+				return
+			}
+
+			body := req.Body
+			// codings are listed in the order they were applied
+			for i := len(codings) - 1; i >= 0; i-- {
+				decoded, decodeErr := decodeBody(codings[i], body, maxSize)
+				if decodeErr != nil {
+					refuseBody(resp, decodeErr)
+					return
+				}
+				body = decoded
+			}
+
+			req.Body = body
+			req.Headers.Del("Content-Encoding")
+			req.Headers.Set("Content-Length", strconv.Itoa(len(body)))
+
+			next(req, resp)
+		}
+	}
+}
+
+// contentCodings returns the codings of Content-Encoding header values,
+// leaving out identity.
+func contentCodings(values []string) []string {
+	var codings []string
+	for _, value := range values {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+
+	return codings
+}
+
+// unsupportedEncodingError is returned for a content coding the server
+// cannot decode.
+type unsupportedEncodingError struct {
+	coding string
+}
+
+func (e *unsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported content encoding %q", e.coding)
+}
+
+func decodeBody(coding string, body []byte, maxSize int64) ([]byte, error) {
+	var reader io.ReadCloser
+	var readerErr error
+	switch coding {
+	case "gzip", "x-gzip":
+		reader, readerErr = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, readerErr = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return nil, &unsupportedEncodingError{coding: coding}
+	}
+	if readerErr != nil {
+		return nil, fmt.Errorf("cannot decode %v body: %w", coding, readerErr)
+	}
+	defer reader.Close()
+
+	// read one byte more than allowed to tell a body of exactly maxSize bytes
+	// from a larger one
+	decoded, readErr := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot decode %v body: %w", coding, readErr)
+	}
+	if int64(len(decoded)) > maxSize {
+		return nil, errBodyTooLarge
+	}
+
+	return decoded, nil
+}
+
+func refuseBody(resp *Response, err error) {
+	var unsupportedErr *unsupportedEncodingError
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		resp.StatusCode = StatusContentTooLarge
+	case errors.As(err, &unsupportedErr):
+		resp.StatusCode = StatusUnsupportedMediaType
+		resp.Headers.Set("Accept-Encoding", "gzip, deflate")
+	default:
+		resp.StatusCode = StatusBadRequest
+	}
+
+	resp.Headers.Set("Content-Type", "text/plain")
+	resp.Body = []byte(err.Error())
+}
@@ -0,0 +1,121 @@
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestDecompressBody(t *testing.T) {
+	text := strings.Repeat("uploaded text ", 100)
+
+	gzipped := func(data string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(data))
+		zw.Close()
+		return buf.Bytes()
+	}
+	deflated := func(data []byte) []byte {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	var testCases = []struct {
+		description     string
+		contentEncoding string
+		body            []byte
+		expectedStatus  int
+		expectedBody    string
+	}{
+		{
+			description:    "plain body",
+			body:           []byte(text),
+			expectedStatus: http.StatusOK,
+			expectedBody:   text,
+		},
+		{
+			description:     "gzip",
+			contentEncoding: "gzip",
+			body:            gzipped(text),
+			expectedStatus:  http.StatusOK,
+			expectedBody:    text,
+		},
+		{
+			description:     "deflate",
+			contentEncoding: "deflate",
+			body:            deflated([]byte(text)),
+			expectedStatus:  http.StatusOK,
+			expectedBody:    text,
+		},
+		{
+			description:     "several codings",
+			contentEncoding: "gzip, deflate",
+			body:            deflated(gzipped(text)),
+			expectedStatus:  http.StatusOK,
+			expectedBody:    text,
+		},
+		{
+			description:     "body of exactly the limit",
+			contentEncoding: "gzip",
+			body:            gzipped(strings.Repeat("a", 2048)),
+			expectedStatus:  http.StatusOK,
+			expectedBody:    strings.Repeat("a", 2048),
+		},
+		{
+			description:     "body over the limit",
+			contentEncoding: "gzip",
+			body:            gzipped(strings.Repeat("a", 2049)),
+			expectedStatus:  http.StatusContentTooLarge,
+			expectedBody:    "decompressed body is too large",
+		},
+		{
+			description:     "invalid body",
+			contentEncoding: "gzip",
+			body:            []byte("not gzip"),
+			expectedStatus:  http.StatusBadRequest,
+			expectedBody:    "cannot decode gzip body: unexpected EOF",
+		},
+		{
+			description:     "unsupported encoding",
+			contentEncoding: "br",
+			body:            []byte(text),
+			expectedStatus:  http.StatusUnsupportedMediaType,
+			expectedBody:    "unsupported content encoding \"br\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := &http.Request{Method: "POST", Path: "/", Body: tc.body}
+			if tc.contentEncoding != "" {
+				req.Headers.Set("Content-Encoding", tc.contentEncoding)
+			}
+
+			resp := http.NewResponse()
+			echo := func(req *http.Request, resp *http.Response) {
+				if req.Headers.Has("Content-Encoding") {
+					t.Errorf("expected Content-Encoding to be removed, got %q", req.Headers.Get("Content-Encoding"))
+				}
+				resp.StatusCode = http.StatusOK
+				resp.Body = req.Body
+			}
+			http.DecompressBody(2048)(echo)(req, resp)
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if string(resp.Body) != tc.expectedBody {
+				t.Errorf("expected body %q, got %q", tc.expectedBody, resp.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"bufio"
+	"time"
+)
+
+// NewConnResponse and Finish expose the server side of Response to tests.
+func NewConnResponse(w *bufio.Writer) *Response {
+	return newConnResponse(w)
+}
+
+func (r *Response) Finish() error {
+	return r.finish()
+}
+
+// SetCertReloadInterval changes how often certificate files are checked for
+// changes and returns a function restoring the previous interval.
+func SetCertReloadInterval(interval time.Duration) func() {
+	previous := certReloadInterval
+	certReloadInterval = interval
+
+	return func() {
+		certReloadInterval = previous
+	}
+}
+
+var NegotiateEncoding = negotiateEncoding
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+// Header holds the header fields of a request or response in the order they
+// were received or added. Names are compared case-insensitively, and a name
+// may occur multiple times (i.e. Set-Cookie).
+//
+// The zero value is an empty header ready to use.
+type Header []HeaderField
+
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// CanonicalHeaderKey returns the canonical form of a header name, i.e.
+// "content-type" becomes "Content-Type".
+func CanonicalHeaderKey(name string) string {
+	return textproto.CanonicalMIMEHeaderKey(name)
+}
+
+// Get returns the first value of the named header or an empty string if
+// there is none.
+func (h Header) Get(name string) string {
+	for _, field := range h {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+
+	return ""
+}
+
+// Values returns all the values of the named header in order.
+func (h Header) Values(name string) []string {
+	var values []string
+	for _, field := range h {
+		if strings.EqualFold(field.Name, name) {
+			values = append(values, field.Value)
+		}
+	}
+
+	return values
+}
+
+func (h Header) Has(name string) bool {
+	for _, field := range h {
+		if strings.EqualFold(field.Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add appends a value to the named header, keeping the existing values.
+func (h *Header) Add(name, value string) {
+	*h = append(*h, HeaderField{Name: CanonicalHeaderKey(name), Value: value})
+}
+
+// Set replaces all the values of the named header with value. The header
+// keeps the position of its first occurrence, or is appended if it is new.
+func (h *Header) Set(name, value string) {
+	name = CanonicalHeaderKey(name)
+
+	fields := (*h)[:0]
+	found := false
+	for _, field := range *h {
+		if !strings.EqualFold(field.Name, name) {
+			fields = append(fields, field)
+			continue
+		}
+
+		if !found {
+			fields = append(fields, HeaderField{Name: name, Value: value})
+			found = true
+		}
+	}
+
+	if !found {
+		fields = append(fields, HeaderField{Name: name, Value: value})
+	}
+
+	*h = fields
+}
+
+// Del removes all the values of the named header.
+func (h *Header) Del(name string) {
+	fields := (*h)[:0]
+	for _, field := range *h {
+		if !strings.EqualFold(field.Name, name) {
+			fields = append(fields, field)
+		}
+	}
+
+	*h = fields
+}
+
+// Names returns the distinct header names in order of first occurrence.
+func (h Header) Names() []string {
+	var names []string
+	for _, field := range h {
+		seen := false
+		for _, name := range names {
+			if strings.EqualFold(name, field.Name) {
+				seen = true
+				break
+			}
+		}
+
+		if !seen {
+			names = append(names, field.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,87 @@
+package http_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestHeader(t *testing.T) {
+	t.Run("names are case-insensitive", func(t *testing.T) {
+		var h http.Header
+		h.Add("user-agent", "curl/8.0")
+
+		if h.Get("User-Agent") != "curl/8.0" {
+			t.Errorf("expected User-Agent to be \"curl/8.0\", got %q", h.Get("User-Agent"))
+		}
+
+		if h.Get("USER-AGENT") != "curl/8.0" {
+			t.Errorf("expected USER-AGENT to be \"curl/8.0\", got %q", h.Get("USER-AGENT"))
+		}
+
+		if h[0].Name != "User-Agent" {
+			t.Errorf("expected name to be canonicalised to \"User-Agent\", got %q", h[0].Name)
+		}
+	})
+
+	t.Run("Add keeps repeated values in order", func(t *testing.T) {
+		var h http.Header
+		h.Add("Set-Cookie", "a=1")
+		h.Add("Content-Type", "text/plain")
+		h.Add("set-cookie", "b=2")
+
+		values := h.Values("Set-Cookie")
+		if !slices.Equal(values, []string{"a=1", "b=2"}) {
+			t.Errorf("expected values [a=1 b=2], got %v", values)
+		}
+
+		if h.Get("Set-Cookie") != "a=1" {
+			t.Errorf("expected Get to return the first value, got %q", h.Get("Set-Cookie"))
+		}
+
+		names := h.Names()
+		if !slices.Equal(names, []string{"Set-Cookie", "Content-Type"}) {
+			t.Errorf("expected names [Set-Cookie Content-Type], got %v", names)
+		}
+	})
+
+	t.Run("Set replaces all values at the position of the first one", func(t *testing.T) {
+		h := http.Header{
+			{Name: "Accept", Value: "text/html"},
+			{Name: "Host", Value: "example.com"},
+			{Name: "Accept", Value: "application/json"},
+		}
+		h.Set("accept", "*/*")
+
+		expected := http.Header{
+			{Name: "Accept", Value: "*/*"},
+			{Name: "Host", Value: "example.com"},
+		}
+		if !slices.Equal(h, expected) {
+			t.Errorf("expected %v, got %v", expected, h)
+		}
+
+		h.Set("Connection", "close")
+		if h[len(h)-1] != (http.HeaderField{Name: "Connection", Value: "close"}) {
+			t.Errorf("expected new header to be appended, got %v", h)
+		}
+	})
+
+	t.Run("Del removes all values", func(t *testing.T) {
+		h := http.Header{
+			{Name: "Accept", Value: "text/html"},
+			{Name: "Host", Value: "example.com"},
+			{Name: "Accept", Value: "application/json"},
+		}
+		h.Del("ACCEPT")
+
+		if h.Has("Accept") {
+			t.Errorf("expected Accept to be removed, got %v", h)
+		}
+
+		if len(h) != 1 || h.Get("Host") != "example.com" {
+			t.Errorf("expected only Host to be left, got %v", h)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package http
+
+import "strings"
+
+// Group registers routes on a mux that share a path prefix and middlewares.
+type Group struct {
+	mux         *Mux
+	prefix      string
+	middlewares []Middleware
+}
+
+// Use adds middlewares to the group. They only wrap routes registered on the
+// group afterwards.
+func (g *Group) Use(middlewares ...Middleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// With returns a nested group with the middlewares of g followed by the given
+// ones.
+func (g *Group) With(middlewares ...Middleware) *Group {
+	return &Group{
+		mux:         g.mux,
+		prefix:      g.prefix,
+		middlewares: append(g.middlewares[:len(g.middlewares):len(g.middlewares)], middlewares...),
+	}
+}
+
+// Group calls fn with a nested group whose routes are registered under the
+// prefix of g followed by prefix. The nested group starts with the
+// middlewares of g.
+func (g *Group) Group(prefix string, fn func(g *Group)) {
+	fn(&Group{
+		mux:         g.mux,
+		prefix:      g.prefix + cleanPrefix(prefix),
+		middlewares: g.middlewares[:len(g.middlewares):len(g.middlewares)],
+	})
+}
+
+// Mount mounts sub under the prefix of g followed by prefix. Requests for sub
+// go through the middlewares of g before the ones of sub. See Mux.Mount.
+func (g *Group) Mount(prefix string, sub *Mux) {
+	g.mux.mount(g.prefix+cleanPrefix(prefix), sub, g.middlewares[:len(g.middlewares):len(g.middlewares)])
+}
+
+// HandleFunc registers a route on the mux under the prefix of the group,
+// wrapped with the middlewares of the group followed by the given ones. The
+// path "/" stands for the prefix itself. See Mux.HandleFunc.
+func (g *Group) HandleFunc(pattern string, handler Handler, middlewares ...Middleware) {
+	method, path, found := strings.Cut(pattern, " ")
+	if found && g.prefix != "" {
+		if path == "/" {
+			path = ""
+		}
+		pattern = method + " " + g.prefix + path
+	}
+
+	g.mux.HandleFunc(pattern, chain(handler, middlewares), g.middlewares...)
+}
+
+// chain wraps handler with middlewares so that the first middleware is the
+// outermost one and runs first.
+func chain(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
@@ -0,0 +1,113 @@
+package http_test
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestMiddleware(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// record returns a middleware appending name to calls before and after
+	// the wrapped handler runs.
+	record := func(calls *[]string, name string) http.Middleware {
+		return func(next http.Handler) http.Handler {
+			return func(req *http.Request, resp *http.Response) {
+				*calls = append(*calls, name)
+				next(req, resp)
+				*calls = append(*calls, "/"+name)
+			}
+		}
+	}
+
+	t.Run("runs mux, group and route middlewares in order", func(t *testing.T) {
+		var calls []string
+
+		mux := http.NewMux(logger)
+		mux.Use(record(&calls, "mux1"), record(&calls, "mux2"))
+
+		group := mux.With(record(&calls, "group1"))
+		group.Use(record(&calls, "group2"))
+		group.HandleFunc("GET /index", func(req *http.Request, resp *http.Response) {
+			calls = append(calls, "handler")
+		}, record(&calls, "route"))
+
+		req := &http.Request{Method: "GET", Path: "/index"}
+		mux.HandleRequest(req, http.NewResponse())
+
+		expected := []string{
+			"mux1", "mux2", "group1", "group2", "route", "handler",
+			"/route", "/group2", "/group1", "/mux2", "/mux1",
+		}
+		if !slices.Equal(calls, expected) {
+			t.Errorf("expected calls %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("mux middlewares wrap requests without route", func(t *testing.T) {
+		var calls []string
+
+		mux := http.NewMux(logger)
+		mux.Use(record(&calls, "mux"))
+
+		req := &http.Request{Method: "GET", Path: "/not-found"}
+		resp := http.NewResponse()
+		mux.HandleRequest(req, resp)
+
+		if resp.StatusCode != 404 {
+			t.Errorf("expected status code 404, got %d", resp.StatusCode)
+		}
+
+		if !slices.Equal(calls, []string{"mux", "/mux"}) {
+			t.Errorf("expected middleware to run, got %v", calls)
+		}
+	})
+
+	t.Run("middleware can short-circuit", func(t *testing.T) {
+		handlerCalled := false
+
+		mux := http.NewMux(logger)
+		mux.Use(func(next http.Handler) http.Handler {
+			return func(req *http.Request, resp *http.Response) {
+				if req.Headers.Get("Authorization") == "" {
+					resp.StatusCode = 401
+					return
+				}
+				next(req, resp)
+			}
+		})
+		mux.HandleFunc("GET /secret", func(req *http.Request, resp *http.Response) {
+			handlerCalled = true
+		})
+
+		req := &http.Request{Method: "GET", Path: "/secret"}
+		resp := http.NewResponse()
+		mux.HandleRequest(req, resp)
+
+		if resp.StatusCode != 401 {
+			t.Errorf("expected status code 401, got %d", resp.StatusCode)
+		}
+
+		if handlerCalled {
+			t.Errorf("expected handler not to be called")
+		}
+	})
+
+	t.Run("route middlewares only wrap their route", func(t *testing.T) {
+		var calls []string
+
+		mux := http.NewMux(logger)
+		mux.HandleFunc("GET /a", func(req *http.Request, resp *http.Response) {}, record(&calls, "a"))
+		mux.HandleFunc("GET /b", func(req *http.Request, resp *http.Response) {})
+
+		mux.HandleRequest(&http.Request{Method: "GET", Path: "/b"}, http.NewResponse())
+
+		if len(calls) != 0 {
+			t.Errorf("expected no middleware to run, got %v", calls)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"mime"
+	"strings"
+)
+
+var (
+	// content types of common file extensions. Text types are given a charset
+	// by TypeByExtension.
+	extensionTypes = map[string]string{
+		".html":        "text/html",
+		".htm":         "text/html",
+		".css":         "text/css",
+		".js":          "text/javascript",
+		".mjs":         "text/javascript",
+		".txt":         "text/plain",
+		".md":          "text/markdown",
+		".csv":         "text/csv",
+		".xml":         "text/xml",
+		".ics":         "text/calendar",
+		".json":        "application/json",
+		".map":         "application/json",
+		".webmanifest": "application/manifest+json",
+		".wasm":        "application/wasm",
+		".pdf":         "application/pdf",
+		".zip":         "application/zip",
+		".gz":          "application/gzip",
+		".tar":         "application/x-tar",
+		".7z":          "application/x-7z-compressed",
+		".bz2":         "application/x-bzip2",
+		".xz":          "application/x-xz",
+		".zst":         "application/zstd",
+		".rar":         "application/x-rar-compressed",
+		".png":         "image/png",
+		".jpg":         "image/jpeg",
+		".jpeg":        "image/jpeg",
+		".gif":         "image/gif",
+		".webp":        "image/webp",
+		".avif":        "image/avif",
+		".svg":         "image/svg+xml",
+		".ico":         "image/x-icon",
+		".bmp":         "image/bmp",
+		".woff":        "font/woff",
+		".woff2":       "font/woff2",
+		".ttf":         "font/ttf",
+		".otf":         "font/otf",
+		".mp3":         "audio/mpeg",
+		".wav":         "audio/wav",
+		".ogg":         "audio/ogg",
+		".mp4":         "video/mp4",
+		".webm":        "video/webm",
+	}
+)
+
+// TypeByExtension returns the content type of files with extension ext,
+// i.e. ".html", or "" if the extension is unknown. ext is looked up in
+// types, which may be nil and whose keys must be lower case, before the
+// built-in table, regardless of its case.
+//
+// Text types are given a UTF-8 charset unless they have one already.
+func TypeByExtension(ext string, types map[string]string) string {
+	ext = strings.ToLower(ext)
+
+	contentType, found := types[ext]
+	if !found {
+		contentType = extensionTypes[ext]
+	}
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, params, parseErr := mime.ParseMediaType(contentType)
+	if parseErr != nil || !strings.HasPrefix(mediaType, "text/") || params["charset"] != "" {
+		return contentType
+	}
+
+	return contentType + "; charset=utf-8"
+}
@@ -0,0 +1,44 @@
+package http_test
+
+import (
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestTypeByExtension(t *testing.T) {
+	types := map[string]string{
+		".md":   "text/x-markdown; charset=iso-8859-1",
+		".png":  "image/x-custom",
+		".data": "text/x-data",
+	}
+
+	var testCases = []struct {
+		ext      string
+		types    map[string]string
+		expected string
+	}{
+		{ext: ".html", expected: "text/html; charset=utf-8"},
+		{ext: ".HTML", expected: "text/html; charset=utf-8"},
+		{ext: ".css", expected: "text/css; charset=utf-8"},
+		{ext: ".js", expected: "text/javascript; charset=utf-8"},
+		{ext: ".json", expected: "application/json"},
+		{ext: ".png", expected: "image/png"},
+		{ext: ".svg", expected: "image/svg+xml"},
+		{ext: ".unknown", expected: ""},
+		{ext: "", expected: ""},
+		{ext: ".md", types: types, expected: "text/x-markdown; charset=iso-8859-1"},
+		{ext: ".png", types: types, expected: "image/x-custom"},
+		{ext: ".data", types: types, expected: "text/x-data; charset=utf-8"},
+		{ext: ".html", types: types, expected: "text/html; charset=utf-8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ext, func(t *testing.T) {
+			contentType := http.TypeByExtension(tc.ext, tc.types)
+			if contentType != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, contentType)
+			}
+		})
+	}
+}
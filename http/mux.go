@@ -4,72 +4,242 @@ import (
 	"fmt"
 	"log/slog"
 	"net/url"
-	"regexp"
 	"slices"
 	"strings"
 )
 
 var (
-	methods           = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
-	pathVariableRegex = regexp.MustCompile(`^{(.+)}$`)
+	methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
 )
 
 type Handler func(*Request, *Response)
 
+// Middleware wraps a handler with cross-cutting behaviour. It may run code
+// before and after calling next, or not call next at all to short-circuit
+// the request.
+type Middleware func(next Handler) Handler
+
 type Mux struct {
-	handlers map[string]Handler
-	logger   *slog.Logger
+	root        *node
+	logger      *slog.Logger
+	middlewares []Middleware
 }
 
 func NewMux(logger *slog.Logger) *Mux {
 	return &Mux{
-		handlers: make(map[string]Handler),
-		logger:   logger,
+		root:   newNode("", "/"),
+		logger: logger,
 	}
 }
 
 func (mux *Mux) HandleRequest(req *Request, resp *Response) {
-	pattern, handler := mux.findHandler(req)
-	if len(pattern) == 0 {
-		mux.logger.Info("cannot find handler", "method", req.Method, "path", req.Path)
+	// set before calling the handler since headers are sent as soon as a
+	// streaming handler flushes
+	connection := req.Headers.Get("Connection")
+	if strings.EqualFold(connection, "close") {
+		resp.Headers.Set("Connection", "close")
 	}
 
-	handler(req, resp)
+	segments, ok := splitPath(req.EscapedPath())
+	if !ok {
+		mux.logger.Info("cannot decode path", "method", req.Method, "path", req.EscapedPath())
+		chain(notFoundHandler, mux.middlewares)(req, resp)
+	} else {
+		mux.serve(req, resp, segments, make(map[string]string))
+	}
 
 	if resp.StatusCode == 0 {
-		resp.StatusCode = 200
+		resp.StatusCode = StatusOK
+	}
+}
+
+// Use adds middlewares wrapping every request handled by the mux, including
+// the ones that end up as 404 or 405. They run before the route is looked
+// up, so Request.Params is not set yet.
+//
+// Middlewares run in the order they are added: mux middlewares first, then
+// the ones of the group the route belongs to, then the route's own. For a
+// mounted mux, the middlewares of the parent run before its own.
+func (mux *Mux) Use(middlewares ...Middleware) {
+	mux.middlewares = append(mux.middlewares, middlewares...)
+}
+
+// With returns a group of routes sharing the given middlewares.
+func (mux *Mux) With(middlewares ...Middleware) *Group {
+	return &Group{
+		mux:         mux,
+		middlewares: middlewares,
+	}
+}
+
+// Group calls fn with a group whose routes are registered under prefix,
+// i.e. "GET /users/{id}" in the "/api/v1" group is "GET /api/v1/users/{id}".
+// The prefix may contain path variables.
+func (mux *Mux) Group(prefix string, fn func(g *Group)) {
+	fn(&Group{
+		mux:    mux,
+		prefix: cleanPrefix(prefix),
+	})
+}
+
+// Mount hands every request whose path starts with prefix over to sub, which
+// sees the rest of the path. Path variables of the prefix are available in
+// Request.Params of the sub mux's handlers. Routes of the mux itself take
+// precedence over mounted muxes.
+func (mux *Mux) Mount(prefix string, sub *Mux) {
+	mux.mount(prefix, sub, nil)
+}
+
+func (mux *Mux) mount(prefix string, sub *Mux, middlewares []Middleware) {
+	if sub == mux {
+		panic(fmt.Errorf("cannot mount a mux on itself"))
 	}
 
-	connection := req.Headers["Connection"]
-	if connection == "close" {
-		resp.Headers["Connection"] = "close"
+	prefix = cleanPrefix(prefix)
+	mountErr := mux.root.mount(prefix, sub, middlewares)
+	if mountErr != nil {
+		panic(mountErr)
 	}
 }
 
-func (mux *Mux) HandleFunc(pattern string, handler Handler) {
+// HandleFunc registers handler for pattern, i.e. "GET /files/{filename}".
+//
+// Path segments are either static, a {name} variable matching a single
+// segment, or a trailing {name...} variable matching the rest of the path.
+// A variable may be constrained, i.e. {id:int}, {id:uuid} or a regular
+// expression the whole segment must match like {slug:[a-z-]+}; a segment
+// failing the constraint doesn't match the route.
+//
+// When several routes match a request, static segments take precedence over
+// constrained variables, then variables, then {name...} variables.
+//
+// middlewares only wrap this route.
+func (mux *Mux) HandleFunc(pattern string, handler Handler, middlewares ...Middleware) {
 	patternErr := mux.validatePattern(pattern)
 	if patternErr != nil {
 		panic(patternErr)
 	}
 
-	_, exists := mux.handlers[pattern]
-	if exists {
-		panic(fmt.Errorf("route pattern \"%s\" already exists", pattern))
+	method, path, _ := strings.Cut(pattern, " ")
+	insertErr := mux.root.insert(method, path, chain(handler, middlewares))
+	if insertErr != nil {
+		panic(insertErr)
+	}
+}
+
+// serve handles a request for the decoded path segments with the mux's
+// middlewares. params holds the path variables matched by parent muxes.
+func (mux *Mux) serve(req *Request, resp *Response, segments []string, params map[string]string) {
+	route := func(req *Request, resp *Response) {
+		pattern, handler := mux.findHandler(req, segments, params)
+		if len(pattern) == 0 {
+			mux.logger.Info("cannot find handler", "method", req.Method, "path", req.Path)
+		}
+
+		handler(req, resp)
+	}
+
+	chain(route, mux.middlewares)(req, resp)
+}
+
+func (mux *Mux) findHandler(req *Request, segments []string, params map[string]string) (string, Handler) {
+	found, rest := mux.match(req.Method, segments, params)
+	if found != nil && found.sub != nil {
+		sub := found.sub
+		dispatch := func(req *Request, resp *Response) {
+			sub.serve(req, resp, rest, params)
+		}
+
+		return "mount " + found.path, chain(dispatch, found.middlewares)
+	}
+
+	if found != nil {
+		req.Params = params
+		return req.Method + " " + found.path, found.handler(req.Method)
+	}
+
+	// No route for the method; look for routes of the path with other methods.
+	allowed := mux.allowedMethods(segments)
+	if len(allowed) == 0 {
+		return "", notFoundHandler
+	}
+
+	allow := strings.Join(allowed, ", ")
+	if req.Method == "OPTIONS" {
+		return "", func(req *Request, resp *Response) {
+			resp.StatusCode = StatusNoContent
+			resp.Headers.Set("Allow", allow)
+		}
 	}
 
-	mux.handlers[pattern] = handler
+	return "", func(req *Request, resp *Response) {
+		resp.StatusCode = StatusMethodNotAllowed
+		resp.Headers.Set("Allow", allow)
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Body = []byte("Method not allowed")
+	}
+}
+
+// match returns the node of the route for method and the path segments,
+// filling params with the path variables. When the route belongs to a
+// mounted mux, the mount node is returned with the segments left for the
+// mounted mux.
+func (mux *Mux) match(method string, segments []string, params map[string]string) (*node, []string) {
+	var rest []string
+	found := mux.root.find(segments, params, func(n *node, remaining []string) bool {
+		if n.sub != nil {
+			rest = remaining
+			found, _ := n.sub.match(method, remaining, make(map[string]string))
+			return found != nil
+		}
+
+		return n.handler(method) != nil
+	})
+
+	return found, rest
 }
 
-func (mux *Mux) findHandler(req *Request) (string, Handler) {
-	for pattern, handler := range mux.handlers {
-		pattern, params := mux.extractParams(req, pattern)
-		if pattern != "" {
-			req.Params = params
-			return pattern, handler
+// allowedMethods returns the methods of all the routes matching the path
+// segments, in the order of the methods list. OPTIONS is always allowed for
+// existing paths since it is answered automatically, and so is HEAD for
+// paths with a GET route.
+func (mux *Mux) allowedMethods(segments []string) []string {
+	registered := make(map[string]bool)
+	mux.registeredMethods(segments, registered)
+
+	if len(registered) == 0 {
+		return nil
+	}
+	registered["OPTIONS"] = true
+	if registered["GET"] {
+		registered["HEAD"] = true
+	}
+
+	var allowed []string
+	for _, method := range methods {
+		if registered[method] {
+			allowed = append(allowed, method)
 		}
 	}
 
-	return "", notFoundHandler
+	return allowed
+}
+
+// registeredMethods adds the methods of all the routes matching the path
+// segments, including the ones of mounted muxes, to registered.
+func (mux *Mux) registeredMethods(segments []string, registered map[string]bool) {
+	// accept never returns true, so every matching route is visited
+	mux.root.find(segments, make(map[string]string), func(n *node, remaining []string) bool {
+		if n.sub != nil {
+			n.sub.registeredMethods(remaining, registered)
+			return false
+		}
+
+		for method := range n.handlers {
+			registered[method] = true
+		}
+		return false
+	})
 }
 
 func (mux *Mux) validatePattern(pattern string) error {
@@ -97,35 +267,30 @@ func (mux *Mux) validatePattern(pattern string) error {
 	return nil
 }
 
-func (mux *Mux) extractParams(req *Request, pattern string) (string, map[string]string) {
-	comps := strings.Split(pattern, " ")
-	method := comps[0]
-
-	if !strings.EqualFold(method, req.Method) {
-		return "", nil
-	}
-
-	pathItems := strings.Split(strings.Trim(comps[1], "/"), "/")
-	reqPathItems := strings.Split(strings.Trim(req.Path, "/"), "/")
-	if len(pathItems) != len(reqPathItems) {
-		return "", nil
-	}
-
-	var params = make(map[string]string)
-	for i, pathItem := range pathItems {
-		matches := pathVariableRegex.FindStringSubmatch(pathItem)
-		if len(matches) == 2 {
-			params[matches[1]] = reqPathItems[i]
-		} else if pathItem != reqPathItems[i] {
-			return "", nil
+// splitPath splits an escaped path into its decoded segments. Segments are
+// split before decoding so that an encoded slash (%2F) stays inside its
+// segment, i.e. "/files/a%2Fb" is ["files", "a/b"].
+func splitPath(escapedPath string) ([]string, bool) {
+	segments := splitPattern(escapedPath)
+	for i, segment := range segments {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, false
 		}
+		segments[i] = decoded
 	}
 
-	return pattern, params
+	return segments, true
+}
+
+// cleanPrefix returns prefix with a leading slash and without trailing
+// slashes; the root prefix is empty.
+func cleanPrefix(prefix string) string {
+	return strings.TrimRight("/"+strings.TrimLeft(prefix, "/"), "/")
 }
 
 func notFoundHandler(req *Request, resp *Response) {
-	resp.StatusCode = 404
-	resp.Headers["Content-Type"] = "text/plain"
+	resp.StatusCode = StatusNotFound
+	resp.Headers.Set("Content-Type", "text/plain")
 	resp.Body = []byte("Not found")
 }
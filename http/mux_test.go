@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
 	"testing"
 
 	"github.com/codecrafters-io/http-server-starter-go/http"
@@ -89,7 +90,7 @@ func TestHandleFunc(t *testing.T) {
 	t.Run("path params", func(t *testing.T) {
 		mux := http.NewMux(logger)
 		mux.HandleFunc("GET /files/{filename}", func(req *http.Request, resp *http.Response) {
-			resp.StatusCode = 200
+			resp.StatusCode = http.StatusOK
 			strBody := fmt.Sprintf("File: %s", req.Params["filename"])
 			resp.Body = []byte(strBody)
 		})
@@ -116,6 +117,36 @@ func TestHandleFunc(t *testing.T) {
 func TestHandleRequest(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
+	t.Run("matches decoded path and unescapes path params", func(t *testing.T) {
+		mux := http.NewMux(logger)
+		mux.HandleFunc("GET /files/{filename}", func(req *http.Request, resp *http.Response) {
+			resp.Body = []byte(req.Params["filename"])
+		})
+
+		var testCases = []struct {
+			target       string
+			expectedBody string
+		}{
+			{target: "/files/foo?x=1", expectedBody: "foo"},
+			{target: "/files/hello%20world", expectedBody: "hello world"},
+			{target: "/files/a%2Fb", expectedBody: "a/b"},
+		}
+
+		for _, tc := range testCases {
+			req, err := http.ParseRequest([]byte(fmt.Sprintf("GET %s HTTP/1.1\r\n\r\n", tc.target)))
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+
+			resp := http.NewResponse()
+			mux.HandleRequest(req, resp)
+
+			if string(resp.Body) != tc.expectedBody {
+				t.Errorf("expected body \"%v\" for %v, got \"%s\"", tc.expectedBody, tc.target, resp.Body)
+			}
+		}
+	})
+
 	t.Run("executes handler that matches route", func(t *testing.T) {
 		mux := http.NewMux(logger)
 		mux.HandleFunc("GET /index", func(req *http.Request, resp *http.Response) {
@@ -178,15 +209,528 @@ func TestHandleRequest(t *testing.T) {
 		req := &http.Request{
 			Method: "GET",
 			Path:   "/index",
-			Headers: map[string]string{
-				"Connection": "close",
+			Headers: http.Header{
+				{Name: "Connection", Value: "close"},
 			},
 		}
 		resp := http.NewResponse()
 		mux.HandleRequest(req, resp)
 
-		if resp.Headers["Connection"] != "close" {
-			t.Errorf("expected Connection header to be 'close', got '%s'", resp.Headers["Connection"])
+		if resp.Headers.Get("Connection") != "close" {
+			t.Errorf("expected Connection header to be 'close', got '%s'", resp.Headers.Get("Connection"))
+		}
+	})
+}
+
+func TestRoutePrecedence(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	mux := http.NewMux(logger)
+	handler := func(name string) http.Handler {
+		return func(req *http.Request, resp *http.Response) {
+			resp.Body = []byte(fmt.Sprintf("%s %v", name, req.Params))
+		}
+	}
+	mux.HandleFunc("GET /files/{filename}", handler("param"))
+	mux.HandleFunc("GET /files/index", handler("static"))
+	mux.HandleFunc("GET /files/{path...}", handler("catch-all"))
+	mux.HandleFunc("GET /files/{filename}/meta", handler("param-meta"))
+	mux.HandleFunc("GET /files/index/{section}", handler("static-param"))
+
+	var testCases = []struct {
+		path         string
+		expectedBody string
+	}{
+		{path: "/files/index", expectedBody: "static map[]"},
+		{path: "/files/foo", expectedBody: "param map[filename:foo]"},
+		{path: "/files/foo/bar/baz", expectedBody: "catch-all map[path:foo/bar/baz]"},
+		{path: "/files/foo/meta", expectedBody: "param-meta map[filename:foo]"},
+		{path: "/files/index/meta", expectedBody: "static-param map[section:meta]"},
+		// static "index" and {filename} lead to dead ends, so the catch-all is used
+		{path: "/files/index/a/b", expectedBody: "catch-all map[path:index/a/b]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			// the same request always gets the same handler
+			for i := 0; i < 10; i++ {
+				req := &http.Request{Method: "GET", Path: tc.path}
+				resp := http.NewResponse()
+				mux.HandleRequest(req, resp)
+
+				if string(resp.Body) != tc.expectedBody {
+					t.Fatalf("expected body \"%v\", got \"%s\"", tc.expectedBody, resp.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestConstrainedParams(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	mux := http.NewMux(logger)
+	handler := func(name string) http.Handler {
+		return func(req *http.Request, resp *http.Response) {
+			resp.Body = []byte(fmt.Sprintf("%s %v", name, req.Params))
+		}
+	}
+	mux.HandleFunc("GET /users/{id:int}", handler("int"))
+	mux.HandleFunc("GET /users/{slug:[a-z-]+}", handler("slug"))
+	mux.HandleFunc("GET /users/{name}", handler("param"))
+	mux.HandleFunc("GET /users/me", handler("static"))
+	mux.HandleFunc("GET /orders/{id:uuid}", handler("uuid"))
+	mux.HandleFunc("GET /codes/{code:[0-9]{3}}", handler("code"))
+
+	var testCases = []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{path: "/users/me", expectedStatus: 200, expectedBody: "static map[]"},
+		{path: "/users/42", expectedStatus: 200, expectedBody: "int map[id:42]"},
+		{path: "/users/-7", expectedStatus: 200, expectedBody: "int map[id:-7]"},
+		{path: "/users/jane-doe", expectedStatus: 200, expectedBody: "slug map[slug:jane-doe]"},
+		{path: "/users/Jane_Doe", expectedStatus: 200, expectedBody: "param map[name:Jane_Doe]"},
+		// the regular expression must match the whole segment
+		{path: "/users/42abc", expectedStatus: 200, expectedBody: "param map[name:42abc]"},
+		{path: "/orders/0b5e4f8a-6c3d-4e2f-9a1b-7c8d9e0f1a2b", expectedStatus: 200,
+			expectedBody: "uuid map[id:0b5e4f8a-6c3d-4e2f-9a1b-7c8d9e0f1a2b]"},
+		{path: "/orders/42", expectedStatus: 404, expectedBody: "Not found"},
+		{path: "/codes/404", expectedStatus: 200, expectedBody: "code map[code:404]"},
+		{path: "/codes/4040", expectedStatus: 404, expectedBody: "Not found"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := &http.Request{Method: "GET", Path: tc.path}
+			resp := http.NewResponse()
+			mux.HandleRequest(req, resp)
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if string(resp.Body) != tc.expectedBody {
+				t.Errorf("expected body \"%v\", got \"%s\"", tc.expectedBody, resp.Body)
+			}
+		})
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	noop := func(req *http.Request, resp *http.Response) {}
+
+	var testCases = []struct {
+		description string
+		patterns    []string
+		expectedMsg string
+	}{
+		{
+			description: "different names for the same path variable",
+			patterns:    []string{"GET /files/{filename}", "POST /files/{name}"},
+			expectedMsg: "path variable {name} in \"/files/{name}\" conflicts with {filename} in \"/files/{filename}\"",
+		},
+		{
+			description: "different names for the same catch-all variable",
+			patterns:    []string{"GET /files/{path...}", "POST /files/{rest...}"},
+			expectedMsg: "path variable {rest...} in \"/files/{rest...}\" conflicts with {path...} in \"/files/{path...}\"",
+		},
+		{
+			description: "catch-all variable that is not the last segment",
+			patterns:    []string{"GET /files/{path...}/meta"},
+			expectedMsg: "\"/files/{path...}/meta\" is invalid. {path...} must be the last segment",
+		},
+		{
+			description: "different names for the same constrained variable",
+			patterns:    []string{"GET /users/{id:int}", "POST /users/{user:int}"},
+			expectedMsg: "path variable {user:int} in \"/users/{user:int}\" conflicts with {id:int} in \"/users/{id:int}\"",
+		},
+		{
+			description: "constrained catch-all variable",
+			patterns:    []string{"GET /files/{path:[a-z]+...}"},
+			expectedMsg: "\"/files/{path:[a-z]+...}\" is invalid. {path...} cannot have a constraint",
+		},
+		{
+			description: "invalid constraint",
+			patterns:    []string{"GET /users/{id:[0-9}"},
+			expectedMsg: "\"/users/{id:[0-9}\" is invalid. constraint of {id} is not a valid regular expression: " +
+				"error parsing regexp: missing closing ]: `[0-9)$`",
+		},
+		{
+			description: "malformed path variable",
+			patterns:    []string{"GET /files/{name"},
+			expectedMsg: "\"/files/{name\" is invalid. segment \"{name\" is not a valid path variable",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			defer func() {
+				err, ok := recover().(error)
+				if !ok {
+					t.Fatalf("expected panic with an error")
+				}
+
+				if err.Error() != tc.expectedMsg {
+					t.Errorf("expected panic message \"%v\", got \"%v\"", tc.expectedMsg, err.Error())
+				}
+			}()
+
+			mux := http.NewMux(logger)
+			for _, pattern := range tc.patterns {
+				mux.HandleFunc(pattern, noop)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	noop := func(req *http.Request, resp *http.Response) {}
+
+	mux := http.NewMux(logger)
+	mux.HandleFunc("GET /files/{filename}", noop)
+	mux.HandleFunc("POST /files/{filename}", noop)
+	mux.HandleFunc("DELETE /files/index", noop)
+	mux.HandleFunc("OPTIONS /custom", func(req *http.Request, resp *http.Response) {
+		resp.StatusCode = http.StatusOK
+		resp.Body = []byte("custom")
+	})
+	mux.HandleFunc("GET /custom", noop)
+
+	var testCases = []struct {
+		description    string
+		method         string
+		path           string
+		expectedStatus int
+		expectedAllow  string
+	}{
+		{
+			description:    "wrong method for existing path",
+			method:         "PUT",
+			path:           "/files/foo",
+			expectedStatus: 405,
+			expectedAllow:  "GET, POST, HEAD, OPTIONS",
+		},
+		{
+			description:    "Allow lists methods of all routes matching the path",
+			method:         "PATCH",
+			path:           "/files/index",
+			expectedStatus: 405,
+			expectedAllow:  "GET, POST, DELETE, HEAD, OPTIONS",
+		},
+		{
+			description:    "automatic OPTIONS",
+			method:         "OPTIONS",
+			path:           "/files/foo",
+			expectedStatus: 204,
+			expectedAllow:  "GET, POST, HEAD, OPTIONS",
+		},
+		{
+			description:    "explicit OPTIONS route wins",
+			method:         "OPTIONS",
+			path:           "/custom",
+			expectedStatus: 200,
+			expectedAllow:  "",
+		},
+		{
+			description:    "unknown path is still not found",
+			method:         "PUT",
+			path:           "/unknown",
+			expectedStatus: 404,
+			expectedAllow:  "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := &http.Request{Method: tc.method, Path: tc.path}
+			resp := http.NewResponse()
+			mux.HandleRequest(req, resp)
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if resp.Headers.Get("Allow") != tc.expectedAllow {
+				t.Errorf("expected Allow header \"%v\", got \"%v\"", tc.expectedAllow, resp.Headers.Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestHead(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	mux := http.NewMux(logger)
+	mux.HandleFunc("GET /echo/{str}", func(req *http.Request, resp *http.Response) {
+		resp.Body = []byte("get " + req.Params["str"])
+	})
+	mux.HandleFunc("GET /custom", func(req *http.Request, resp *http.Response) {
+		resp.Body = []byte("get")
+	})
+	mux.HandleFunc("HEAD /custom", func(req *http.Request, resp *http.Response) {
+		resp.Body = []byte("head")
+	})
+	mux.HandleFunc("POST /upload", func(req *http.Request, resp *http.Response) {})
+
+	t.Run("falls back to GET route", func(t *testing.T) {
+		req := &http.Request{Method: "HEAD", Path: "/echo/foo"}
+		resp := http.NewResponse()
+		mux.HandleRequest(req, resp)
+
+		if string(resp.Body) != "get foo" {
+			t.Errorf("expected GET handler to run, got body \"%s\"", resp.Body)
+		}
+	})
+
+	t.Run("explicit HEAD route wins", func(t *testing.T) {
+		req := &http.Request{Method: "HEAD", Path: "/custom"}
+		resp := http.NewResponse()
+		mux.HandleRequest(req, resp)
+
+		if string(resp.Body) != "head" {
+			t.Errorf("expected HEAD handler to run, got body \"%s\"", resp.Body)
+		}
+	})
+
+	t.Run("path without GET route is not allowed", func(t *testing.T) {
+		req := &http.Request{Method: "HEAD", Path: "/upload"}
+		resp := http.NewResponse()
+		mux.HandleRequest(req, resp)
+
+		if resp.StatusCode != 405 {
+			t.Errorf("expected status code 405, got %d", resp.StatusCode)
 		}
+
+		if resp.Headers.Get("Allow") != "POST, OPTIONS" {
+			t.Errorf("expected Allow header \"POST, OPTIONS\", got \"%v\"", resp.Headers.Get("Allow"))
+		}
+	})
+}
+
+func TestGroup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var calls []string
+	record := func(name string) http.Middleware {
+		return func(next http.Handler) http.Handler {
+			return func(req *http.Request, resp *http.Response) {
+				calls = append(calls, name)
+				next(req, resp)
+			}
+		}
+	}
+	echoParams := func(req *http.Request, resp *http.Response) {
+		resp.Body = []byte(fmt.Sprintf("%v %v", req.Params["user"], req.Params["post"]))
+	}
+
+	mux := http.NewMux(logger)
+	mux.Group("/users/{user}", func(g *http.Group) {
+		g.Use(record("users"))
+		g.HandleFunc("GET /", echoParams)
+		g.Group("/posts", func(g *http.Group) {
+			g.Use(record("posts"))
+			g.HandleFunc("GET /{post}", echoParams)
+		})
+	})
+
+	var testCases = []struct {
+		description    string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+		expectedCalls  []string
+	}{
+		{
+			description:    "route at the prefix",
+			method:         "GET",
+			path:           "/users/42",
+			expectedStatus: 200,
+			expectedBody:   "42 ",
+			expectedCalls:  []string{"users"},
+		},
+		{
+			description:    "nested group shares prefix params and middlewares",
+			method:         "GET",
+			path:           "/users/42/posts/7",
+			expectedStatus: 200,
+			expectedBody:   "42 7",
+			expectedCalls:  []string{"users", "posts"},
+		},
+		{
+			description:    "wrong method under the prefix",
+			method:         "POST",
+			path:           "/users/42/posts/7",
+			expectedStatus: 405,
+			expectedBody:   "Method not allowed",
+		},
+		{
+			description:    "unknown path under the prefix",
+			method:         "GET",
+			path:           "/users/42/comments",
+			expectedStatus: 404,
+			expectedBody:   "Not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			calls = nil
+
+			req := &http.Request{Method: tc.method, Path: tc.path}
+			resp := http.NewResponse()
+			mux.HandleRequest(req, resp)
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if string(resp.Body) != tc.expectedBody {
+				t.Errorf("expected body \"%s\", got \"%s\"", tc.expectedBody, resp.Body)
+			}
+
+			if !slices.Equal(calls, tc.expectedCalls) {
+				t.Errorf("expected middlewares %v, got %v", tc.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestMount(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var calls []string
+	record := func(name string) http.Middleware {
+		return func(next http.Handler) http.Handler {
+			return func(req *http.Request, resp *http.Response) {
+				calls = append(calls, name)
+				next(req, resp)
+			}
+		}
+	}
+	respond := func(body string) http.Handler {
+		return func(req *http.Request, resp *http.Response) {
+			resp.Body = []byte(fmt.Sprintf("%s %v", body, req.Params))
+		}
+	}
+
+	sub := http.NewMux(logger)
+	sub.Use(record("sub"))
+	sub.HandleFunc("GET /", respond("sub index"))
+	sub.HandleFunc("GET /items/{item}", respond("sub item"))
+	sub.HandleFunc("DELETE /items/{item}", respond("sub delete"))
+
+	mux := http.NewMux(logger)
+	mux.Use(record("mux"))
+	mux.HandleFunc("GET /api/{tenant}/health", respond("health"))
+	mux.HandleFunc("PUT /api/{tenant}/items/{item}", respond("parent put"))
+	mux.With(record("group")).Mount("/api/{tenant}", sub)
+
+	var testCases = []struct {
+		description    string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+		expectedAllow  string
+		expectedCalls  []string
+	}{
+		{
+			description:    "mounted index",
+			method:         "GET",
+			path:           "/api/acme",
+			expectedStatus: 200,
+			expectedBody:   "sub index map[tenant:acme]",
+			expectedCalls:  []string{"mux", "group", "sub"},
+		},
+		{
+			description:    "mounted route sees prefix params",
+			method:         "GET",
+			path:           "/api/acme/items/7",
+			expectedStatus: 200,
+			expectedBody:   "sub item map[item:7 tenant:acme]",
+			expectedCalls:  []string{"mux", "group", "sub"},
+		},
+		{
+			description:    "parent route takes precedence",
+			method:         "GET",
+			path:           "/api/acme/health",
+			expectedStatus: 200,
+			expectedBody:   "health map[tenant:acme]",
+			expectedCalls:  []string{"mux"},
+		},
+		{
+			description:    "parent route for another method of a mounted path",
+			method:         "PUT",
+			path:           "/api/acme/items/7",
+			expectedStatus: 200,
+			expectedBody:   "parent put map[item:7 tenant:acme]",
+			expectedCalls:  []string{"mux"},
+		},
+		{
+			description:    "Allow lists methods of parent and mounted routes",
+			method:         "POST",
+			path:           "/api/acme/items/7",
+			expectedStatus: 405,
+			expectedBody:   "Method not allowed",
+			expectedAllow:  "GET, PUT, DELETE, HEAD, OPTIONS",
+			expectedCalls:  []string{"mux"},
+		},
+		{
+			description:    "automatic OPTIONS through the mount",
+			method:         "OPTIONS",
+			path:           "/api/acme",
+			expectedStatus: 204,
+			expectedAllow:  "GET, HEAD, OPTIONS",
+			expectedCalls:  []string{"mux"},
+		},
+		{
+			description:    "unknown path under the mount",
+			method:         "GET",
+			path:           "/api/acme/unknown",
+			expectedStatus: 404,
+			expectedBody:   "Not found",
+			expectedCalls:  []string{"mux"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			calls = nil
+
+			req := &http.Request{Method: tc.method, Path: tc.path}
+			resp := http.NewResponse()
+			mux.HandleRequest(req, resp)
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if string(resp.Body) != tc.expectedBody {
+				t.Errorf("expected body \"%s\", got \"%s\"", tc.expectedBody, resp.Body)
+			}
+
+			if resp.Headers.Get("Allow") != tc.expectedAllow {
+				t.Errorf("expected Allow header \"%v\", got \"%v\"", tc.expectedAllow, resp.Headers.Get("Allow"))
+			}
+
+			if !slices.Equal(calls, tc.expectedCalls) {
+				t.Errorf("expected middlewares %v, got %v", tc.expectedCalls, calls)
+			}
+		})
+	}
+
+	t.Run("mounting twice at the same prefix panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected Mount to panic")
+			}
+		}()
+
+		mux.Mount("/api/{tenant}", http.NewMux(logger))
 	})
 }
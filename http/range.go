@@ -0,0 +1,119 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrRangeNotSatisfiable is returned by ParseRange when none of the
+	// requested ranges overlaps the body.
+	ErrRangeNotSatisfiable = errors.New("requested range not satisfiable")
+)
+
+// ByteRange is a span of a body of Length bytes starting at byte Start.
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange returns the Content-Range header value of the range of a body
+// of size bytes, i.e. "bytes 0-499/1234".
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header, i.e. "bytes=0-499, -500", for a body of
+// size bytes. Ranges reaching past the end of the body are shortened and
+// ranges starting after it are left out. It returns ErrRangeNotSatisfiable
+// if no range is left.
+//
+// It returns no ranges and no error, meaning the whole body should be sent,
+// for a header that is empty, malformed, not in bytes, or asks for more
+// than the whole body in total (i.e. many overlapping ranges).
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	unit, specs, found := strings.Cut(header, "=")
+	if !found || strings.TrimSpace(unit) != "bytes" {
+		return nil, nil
+	}
+
+	var ranges []ByteRange
+	var total int64
+	satisfiable := false
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		r, ok, valid := parseRangeSpec(spec, size)
+		if !valid {
+			return nil, nil
+		}
+		if !ok {
+			continue
+		}
+
+		satisfiable = true
+		ranges = append(ranges, r)
+		total += r.Length
+	}
+
+	if !satisfiable {
+		return nil, ErrRangeNotSatisfiable
+	}
+
+	if total > size {
+		return nil, nil
+	}
+
+	return ranges, nil
+}
+
+// parseRangeSpec parses a single range, i.e. "0-499", "500-" or "-500". ok
+// is false for a valid range that doesn't overlap the body, and valid is
+// false for a malformed range.
+func parseRangeSpec(spec string, size int64) (r ByteRange, ok bool, valid bool) {
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return ByteRange{}, false, false
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+	// suffix range: the last bytes of the body
+	if first == "" {
+		suffix, parseErr := strconv.ParseInt(last, 10, 64)
+		if parseErr != nil || suffix < 0 {
+			return ByteRange{}, false, false
+		}
+
+		if suffix == 0 || size == 0 {
+			return ByteRange{}, false, true
+		}
+
+		suffix = min(suffix, size)
+		return ByteRange{Start: size - suffix, Length: suffix}, true, true
+	}
+
+	start, parseErr := strconv.ParseInt(first, 10, 64)
+	if parseErr != nil || start < 0 {
+		return ByteRange{}, false, false
+	}
+
+	end := size - 1
+	if last != "" {
+		end, parseErr = strconv.ParseInt(last, 10, 64)
+		if parseErr != nil || end < start {
+			return ByteRange{}, false, false
+		}
+		end = min(end, size-1)
+	}
+
+	if start >= size {
+		return ByteRange{}, false, true
+	}
+
+	return ByteRange{Start: start, Length: end - start + 1}, true, true
+}
@@ -0,0 +1,259 @@
+package http_test
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestParseRange(t *testing.T) {
+	var testCases = []struct {
+		header         string
+		expectedRanges []http.ByteRange
+		expectedErr    error
+	}{
+		{header: "bytes=0-4", expectedRanges: []http.ByteRange{{Start: 0, Length: 5}}},
+		{header: "bytes=5-", expectedRanges: []http.ByteRange{{Start: 5, Length: 5}}},
+		{header: "bytes=-3", expectedRanges: []http.ByteRange{{Start: 7, Length: 3}}},
+		{header: "bytes=-20", expectedRanges: []http.ByteRange{{Start: 0, Length: 10}}},
+		{header: "bytes=8-20", expectedRanges: []http.ByteRange{{Start: 8, Length: 2}}},
+		{header: "bytes= 0-1 , 4-5", expectedRanges: []http.ByteRange{{Start: 0, Length: 2}, {Start: 4, Length: 2}}},
+		{header: "bytes=0-1,20-30", expectedRanges: []http.ByteRange{{Start: 0, Length: 2}}},
+		{header: "bytes=10-", expectedErr: http.ErrRangeNotSatisfiable},
+		{header: "bytes=10-20,-0", expectedErr: http.ErrRangeNotSatisfiable},
+		{header: "bytes=0-9,0-9"},
+		{header: "bytes=4-2"},
+		{header: "bytes=a-b"},
+		{header: "bytes=1"},
+		{header: "lines=0-4"},
+		{header: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			ranges, err := http.ParseRange(tc.header, 10)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if !reflect.DeepEqual(ranges, tc.expectedRanges) {
+				t.Errorf("expected ranges %v, got %v", tc.expectedRanges, ranges)
+			}
+		})
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	content := "0123456789"
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	lastModified := "Wed, 01 May 2024 12:00:00 GMT"
+
+	var testCases = []struct {
+		description          string
+		method               string
+		headers              map[string]string
+		expectedStatus       int
+		expectedContentRange string
+		expectedBody         string
+	}{
+		{
+			description:    "no range",
+			method:         "GET",
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:          "single range",
+			method:               "GET",
+			headers:              map[string]string{"Range": "bytes=2-4"},
+			expectedStatus:       http.StatusPartialContent,
+			expectedContentRange: "bytes 2-4/10",
+			expectedBody:         "234",
+		},
+		{
+			description:          "suffix range",
+			method:               "GET",
+			headers:              map[string]string{"Range": "bytes=-2"},
+			expectedStatus:       http.StatusPartialContent,
+			expectedContentRange: "bytes 8-9/10",
+			expectedBody:         "89",
+		},
+		{
+			description:          "unsatisfiable range",
+			method:               "GET",
+			headers:              map[string]string{"Range": "bytes=20-"},
+			expectedStatus:       http.StatusRangeNotSatisfiable,
+			expectedContentRange: "bytes */10",
+			expectedBody:         "Range Not Satisfiable",
+		},
+		{
+			description:    "malformed range",
+			method:         "GET",
+			headers:        map[string]string{"Range": "bytes=x"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "range of a POST request",
+			method:         "POST",
+			headers:        map[string]string{"Range": "bytes=2-4"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:          "If-Range with the modification date",
+			method:               "GET",
+			headers:              map[string]string{"Range": "bytes=2-4", "If-Range": lastModified},
+			expectedStatus:       http.StatusPartialContent,
+			expectedContentRange: "bytes 2-4/10",
+			expectedBody:         "234",
+		},
+		{
+			description:    "If-Range with another date",
+			method:         "GET",
+			headers:        map[string]string{"Range": "bytes=2-4", "If-Range": "Tue, 30 Apr 2024 12:00:00 GMT"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "If-Range with an entity tag",
+			method:         "GET",
+			headers:        map[string]string{"Range": "bytes=2-4", "If-Range": "\"abc\""},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := &http.Request{Method: tc.method, Path: "/"}
+			for name, value := range tc.headers {
+				req.Headers.Set(name, value)
+			}
+
+			resp := http.NewResponse()
+			err := http.ServeContent(req, resp, strings.NewReader(content), int64(len(content)), modTime)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if contentRange := resp.Headers.Get("Content-Range"); contentRange != tc.expectedContentRange {
+				t.Errorf("expected Content-Range %q, got %q", tc.expectedContentRange, contentRange)
+			}
+
+			if body := readBody(t, resp); body != tc.expectedBody {
+				t.Errorf("expected body %q, got %q", tc.expectedBody, body)
+			}
+
+			if acceptRanges := resp.Headers.Get("Accept-Ranges"); acceptRanges != "bytes" {
+				t.Errorf("expected Accept-Ranges bytes, got %q", acceptRanges)
+			}
+
+			if modified := resp.Headers.Get("Last-Modified"); modified != lastModified {
+				t.Errorf("expected Last-Modified %q, got %q", lastModified, modified)
+			}
+		})
+	}
+
+	t.Run("multiple ranges", func(t *testing.T) {
+		req := &http.Request{Method: "GET", Path: "/"}
+		req.Headers.Set("Range", "bytes=0-1,-3")
+
+		resp := http.NewResponse()
+		resp.Headers.Set("Content-Type", "text/plain")
+		err := http.ServeContent(req, resp, strings.NewReader(content), int64(len(content)), modTime)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusPartialContent, resp.StatusCode)
+		}
+
+		mediaType, params, err := mime.ParseMediaType(resp.Headers.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Fatalf("expected multipart/byteranges, got %q", resp.Headers.Get("Content-Type"))
+		}
+
+		expectedParts := []struct{ contentRange, body string }{
+			{"bytes 0-1/10", "01"},
+			{"bytes 7-9/10", "789"},
+		}
+		body := readBody(t, resp)
+		if contentLength := resp.Headers.Get("Content-Length"); contentLength != strconv.Itoa(len(body)) {
+			t.Errorf("expected Content-Length %d, got %q", len(body), contentLength)
+		}
+
+		mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+		for _, expected := range expectedParts {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Fatalf("expected part %v, got %v", expected.contentRange, err)
+			}
+
+			if contentType := part.Header.Get("Content-Type"); contentType != "text/plain" {
+				t.Errorf("expected part Content-Type text/plain, got %q", contentType)
+			}
+
+			if contentRange := part.Header.Get("Content-Range"); contentRange != expected.contentRange {
+				t.Errorf("expected part Content-Range %q, got %q", expected.contentRange, contentRange)
+			}
+
+			body, _ := io.ReadAll(part)
+			if string(body) != expected.body {
+				t.Errorf("expected part body %q, got %q", expected.body, body)
+			}
+		}
+
+		if _, err := mr.NextPart(); err != io.EOF {
+			t.Errorf("expected no more parts, got %v", err)
+		}
+	})
+
+	t.Run("HEAD request", func(t *testing.T) {
+		req := &http.Request{Method: "HEAD", Path: "/"}
+
+		resp := http.NewResponse()
+		err := http.ServeContent(req, resp, strings.NewReader(content), int64(len(content)), modTime)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(resp.Body) != 0 {
+			t.Errorf("expected no body, got %q", resp.Body)
+		}
+
+		if contentLength := resp.Headers.Get("Content-Length"); contentLength != "10" {
+			t.Errorf("expected Content-Length 10, got %q", contentLength)
+		}
+	})
+}
+
+// readBody returns the body of a response, reading its BodyReader if it has
+// one.
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	if resp.BodyReader == nil {
+		return string(resp.Body)
+	}
+
+	body, err := io.ReadAll(resp.BodyReader)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+
+	return string(resp.Body) + string(body)
+}
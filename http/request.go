@@ -1,25 +1,84 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultMaxBodySize is the largest request body ReadRequest accepts, and
+	// the server unless Server.MaxBodySize is set.
+	DefaultMaxBodySize = 64 << 20 // 64MB
+
+	// limits of the headers of a request, and of the trailers of a chunked body
+	maxHeaderBytes = 64 * 1024 // 64KB
+	maxHeaders     = 100
 )
 
 var (
-	delimiter = []byte("\r\n")
+	errLineTooLong = errors.New("line is too long")
+
+	// errRequestLineTooLong is answered with 414 by the server.
+	errRequestLineTooLong = errors.New("request line is too long")
+
+	// errHeadersTooLarge is answered with 431 by the server.
+	errHeadersTooLarge = errors.New("request headers are too large")
+
+	// errRequestBodyTooLarge is answered with 413 by the server.
+	errRequestBodyTooLarge = errors.New("request body is too large")
 )
 
 type Request struct {
-	Method   string
-	Path     string
+	Method string
+	// Path is the percent-decoded path of the request target, i.e.
+	// "/echo/hello world" for "GET /echo/hello%20world?x=1".
+	Path string
+	// RawPath is the path as sent by the client, i.e. "/echo/hello%20world".
+	RawPath string
+	// RawQuery is the query string without the leading "?", i.e. "x=1".
+	RawQuery string
+	Query    url.Values
 	Protocol string
-	Headers  map[string]string
+	Headers  Header
 	Body     []byte
 	Params   map[string]string
+
+	// Trailers holds the trailer headers sent after a chunked body.
+	Trailers Header
 }
 
+// ParseRequest parses a complete HTTP request held in memory.
 func ParseRequest(data []byte) (*Request, error) {
+	return ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+}
+
+// ReadRequest reads exactly one HTTP request from r. Bytes following the
+// request (i.e. a pipelined request on a keep-alive connection) are left
+// in r for the next call. Bodies larger than DefaultMaxBodySize are refused.
+//
+// io.EOF is returned as is when r is exhausted before the request line
+// starts, meaning that the client has closed the connection.
+func ReadRequest(r *bufio.Reader) (*Request, error) {
+	req, headErr := readRequestHead(r)
+	if headErr != nil {
+		return nil, headErr
+	}
+
+	bodyErr := readRequestBody(r, req, DefaultMaxBodySize)
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+
+	return req, nil
+}
+
+func readRequestHead(r *bufio.Reader) (*Request, error) {
 	// http request format:
 	//
 	// POST /index HTTP/1.1\r\n
@@ -27,57 +86,242 @@ func ParseRequest(data []byte) (*Request, error) {
 	// \r\n
 	// body
 
-	lines := bytes.Split(data, delimiter)
-	if len(lines) < 1 {
-		return nil, fmt.Errorf("invalid request format")
-	}
-
 	// first line is the request line
 	// e.g., "GET /index HTTP/1.1"
-	requestLineParts := bytes.SplitN(lines[0], []byte(" "), 3)
+	requestLine, readErr := readLine(r)
+	if readErr != nil {
+		if errors.Is(readErr, errLineTooLong) {
+			return nil, errRequestLineTooLong
+		}
+		return nil, readErr
+	}
+
+	requestLineParts := bytes.SplitN(requestLine, []byte(" "), 3)
 	if len(requestLineParts) < 3 {
 		return nil, fmt.Errorf("invalid request line format")
 	}
 
+	req := &Request{
+		Method:   string(requestLineParts[0]),
+		Protocol: string(requestLineParts[2]),
+	}
+
+	targetErr := req.parseTarget(string(requestLineParts[1]))
+	if targetErr != nil {
+		return nil, targetErr
+	}
+
 	// headers
-	headers := make(map[string]string)
-	for _, line := range lines[1:] {
+	headers, headersErr := readHeaders(r)
+	if headersErr != nil {
+		return nil, headersErr
+	}
+	req.Headers = headers
+
+	return req, nil
+}
+
+// readHeaders reads header lines up to and including the empty line that
+// terminates them. It is used for both request headers and chunked trailers.
+// More than maxHeaders lines or maxHeaderBytes bytes are refused with
+// errHeadersTooLarge.
+func readHeaders(r *bufio.Reader) (Header, error) {
+	var headers Header
+	size := 0
+	for {
+		line, readErr := readLine(r)
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				return nil, fmt.Errorf("invalid end of headers")
+			}
+			if errors.Is(readErr, errLineTooLong) {
+				return nil, errHeadersTooLarge
+			}
+			return nil, readErr
+		}
+
 		if len(line) == 0 {
 			break // End of headers
 		}
 
+		size += len(line)
+		if size > maxHeaderBytes || len(headers) >= maxHeaders {
+			return nil, errHeadersTooLarge
+		}
+
 		headerParts := bytes.SplitN(line, []byte(":"), 2)
 		if len(headerParts) != 2 {
 			return nil, fmt.Errorf("invalid header format: %s", line)
 		}
 		key := string(bytes.TrimSpace(headerParts[0]))
 		value := string(bytes.TrimSpace(headerParts[1]))
-		headers[key] = value
+		headers.Add(key, value)
 	}
 
-	// body
-	bodyStartIndex := bytes.Index(data, []byte("\r\n\r\n"))
-	if bodyStartIndex == -1 {
-		return nil, fmt.Errorf("invalid end of headers")
-	}
-	bodyStartIndex = bodyStartIndex + 4 // +4 to skip the \r\n\r\n
-
-	var body []byte
-	contentLength, exists := headers["Content-Length"]
-	if exists {
-		contentLengthInt, err := strconv.Atoi(contentLength)
-		if err != nil {
-			return nil, fmt.Errorf("invalid Content-Length header: %s", contentLength)
+	return headers, nil
+}
+
+// parseTarget splits the request target into path and query.
+func (req *Request) parseTarget(target string) error {
+	// asterisk-form, i.e. "OPTIONS * HTTP/1.1"
+	if target == "*" {
+		req.Path = target
+		req.RawPath = target
+		req.Query = url.Values{}
+		return nil
+	}
+
+	u, parseErr := url.ParseRequestURI(target)
+	if parseErr != nil {
+		return fmt.Errorf("invalid request target: %s", target)
+	}
+
+	req.Path = u.Path
+	req.RawPath = u.EscapedPath()
+	req.RawQuery = u.RawQuery
+	// malformed pairs are skipped; the rest of the query is still usable
+	req.Query, _ = url.ParseQuery(u.RawQuery)
+
+	return nil
+}
+
+// EscapedPath returns the path as sent by the client, falling back to Path
+// for requests that were not parsed from the wire.
+func (req *Request) EscapedPath() string {
+	if req.RawPath != "" {
+		return req.RawPath
+	}
+
+	return req.Path
+}
+
+// ParamInt returns the path variable name as an int. It returns an error if
+// the route has no such variable or its value is not an integer; routes
+// with a {name:int} variable always get a valid value.
+func (req *Request) ParamInt(name string) (int, error) {
+	value, exists := req.Params[name]
+	if !exists {
+		return 0, fmt.Errorf("path variable {%v} is not set", name)
+	}
+
+	n, parseErr := strconv.Atoi(value)
+	if parseErr != nil {
+		return 0, fmt.Errorf("path variable {%v} is not an integer: %w", name, parseErr)
+	}
+
+	return n, nil
+}
+
+// ParamUint returns the path variable name as a uint64. It returns an error
+// if the route has no such variable or its value is not an unsigned integer.
+func (req *Request) ParamUint(name string) (uint64, error) {
+	value, exists := req.Params[name]
+	if !exists {
+		return 0, fmt.Errorf("path variable {%v} is not set", name)
+	}
+
+	n, parseErr := strconv.ParseUint(value, 10, 64)
+	if parseErr != nil {
+		return 0, fmt.Errorf("path variable {%v} is not an unsigned integer: %w", name, parseErr)
+	}
+
+	return n, nil
+}
+
+// readRequestBody reads the body of req, refusing bodies larger than maxSize
+// bytes with errRequestBodyTooLarge.
+func readRequestBody(r *bufio.Reader, req *Request, maxSize int64) error {
+	transferEncoding := req.Headers.Get("Transfer-Encoding")
+	hasTransferEncoding := req.Headers.Has("Transfer-Encoding")
+	contentLength := req.Headers.Get("Content-Length")
+	hasContentLength := req.Headers.Has("Content-Length")
+
+	if hasTransferEncoding {
+		// A request carrying both headers is a classic request smuggling
+		// vector, so it is refused rather than guessing which one to trust.
+		if hasContentLength {
+			return fmt.Errorf("request has both Transfer-Encoding and Content-Length headers")
+		}
+
+		if !strings.EqualFold(transferEncoding, "chunked") {
+			return fmt.Errorf("unsupported Transfer-Encoding: %s", transferEncoding)
 		}
 
-		body = data[bodyStartIndex : bodyStartIndex+contentLengthInt]
+		body, trailers, chunkedErr := readChunkedBody(r, maxSize)
+		if chunkedErr != nil {
+			return fmt.Errorf("cannot read chunked request body: %w", chunkedErr)
+		}
+		req.Body = body
+		req.Trailers = trailers
+
+		return nil
 	}
 
-	return &Request{
-		Method:   string(requestLineParts[0]),
-		Path:     string(requestLineParts[1]),
-		Protocol: string(requestLineParts[2]),
-		Headers:  headers,
-		Body:     body,
-	}, nil
+	if !hasContentLength {
+		return nil
+	}
+
+	// Repeated Content-Length headers are only accepted when they agree.
+	for _, value := range req.Headers.Values("Content-Length") {
+		if value != contentLength {
+			return fmt.Errorf("request has conflicting Content-Length headers")
+		}
+	}
+
+	contentLengthInt, err := strconv.ParseInt(contentLength, 10, 64)
+	if err != nil || contentLengthInt < 0 {
+		return fmt.Errorf("invalid Content-Length header: %s", contentLength)
+	}
+
+	if contentLengthInt > maxSize {
+		return errRequestBodyTooLarge
+	}
+
+	// the buffer grows as the body arrives rather than trusting the client
+	// to send as many bytes as it claims
+	var body bytes.Buffer
+	n, readErr := io.Copy(&body, io.LimitReader(r, contentLengthInt))
+	if readErr == nil && n < contentLengthInt {
+		readErr = io.ErrUnexpectedEOF
+	}
+	if readErr != nil {
+		return fmt.Errorf("cannot read request body: %w", readErr)
+	}
+	req.Body = body.Bytes()
+
+	return nil
+}
+
+// readLine reads a single line terminated by \r\n (or a bare \n) and returns
+// it without the line terminator. Lines may be longer than the buffer of r,
+// up to maxHeaderBytes; longer ones are refused with errLineTooLong. The
+// returned slice is only valid until the next read from r.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	// parts of a line that didn't fit in the buffer of r
+	var long []byte
+
+	for {
+		line, readErr := r.ReadSlice('\n')
+		if len(long)+len(line) > maxHeaderBytes {
+			return nil, errLineTooLong
+		}
+
+		if errors.Is(readErr, bufio.ErrBufferFull) {
+			long = append(long, line...)
+			continue
+		}
+		if long != nil {
+			line = append(long, line...)
+		}
+
+		if readErr != nil {
+			// A last line without terminator is still handed to the caller;
+			// the following read reports io.EOF.
+			if !errors.Is(readErr, io.EOF) || len(line) == 0 {
+				return nil, readErr
+			}
+		}
+
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
 }
@@ -1,8 +1,14 @@
 package http_test
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/codecrafters-io/http-server-starter-go/http"
 )
@@ -26,8 +32,8 @@ func TestParseRequest(t *testing.T) {
 				Method:   "GET",
 				Path:     "/",
 				Protocol: "HTTP/1.1",
-				Headers: map[string]string{
-					"Host": "example.com",
+				Headers: http.Header{
+					{Name: "Host", Value: "example.com"},
 				},
 			},
 		},
@@ -38,9 +44,9 @@ func TestParseRequest(t *testing.T) {
 				Method:   "GET",
 				Path:     "/foo",
 				Protocol: "HTTP/1.1",
-				Headers: map[string]string{
-					"Host":       "example.com",
-					"User-Agent": "mango/pear-raspberry",
+				Headers: http.Header{
+					{Name: "Host", Value: "example.com"},
+					{Name: "User-Agent", Value: "mango/pear-raspberry"},
 				},
 			},
 		},
@@ -51,9 +57,9 @@ func TestParseRequest(t *testing.T) {
 				Method:   "POST",
 				Path:     "/foo",
 				Protocol: "HTTP/1.1",
-				Headers: map[string]string{
-					"Host":           "example.com",
-					"Content-Length": "6",
+				Headers: http.Header{
+					{Name: "Host", Value: "example.com"},
+					{Name: "Content-Length", Value: "6"},
 				},
 				Body: []byte("foobar"),
 			},
@@ -90,16 +96,283 @@ func TestParseRequest(t *testing.T) {
 				tt.Errorf("expected %v headers but got %v", len(tc.expectedRequest.Headers), len(req.Headers))
 			}
 
-			for name, value := range req.Headers {
-				if tc.expectedRequest.Headers[name] != value {
+			for i, field := range req.Headers {
+				if i >= len(tc.expectedRequest.Headers) {
+					break
+				}
+
+				expected := tc.expectedRequest.Headers[i]
+				if expected != field {
 					tt.Errorf(
-						"expected %v header to have value %v but got %v",
-						name,
-						tc.expectedRequest.Headers[name],
-						value,
+						"expected header #%d to be %v: %v but got %v: %v",
+						i,
+						expected.Name,
+						expected.Value,
+						field.Name,
+						field.Value,
 					)
 				}
 			}
 		})
 	}
 }
+
+func TestReadRequest(t *testing.T) {
+	t.Run("reads pipelined requests one at a time", func(t *testing.T) {
+		raw := "POST /first HTTP/1.1\r\nContent-Length: 3\r\n\r\nfoo" +
+			"GET /second HTTP/1.1\r\nHost: example.com\r\n\r\n"
+		reader := bufio.NewReader(strings.NewReader(raw))
+
+		first, err := http.ReadRequest(reader)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if first.Path != "/first" || string(first.Body) != "foo" {
+			t.Errorf("unexpected first request: %v %q", first.Path, first.Body)
+		}
+
+		second, err := http.ReadRequest(reader)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if second.Path != "/second" || len(second.Body) != 0 {
+			t.Errorf("unexpected second request: %v %q", second.Path, second.Body)
+		}
+
+		_, err = http.ReadRequest(reader)
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("expected io.EOF but got %v", err)
+		}
+	})
+
+	t.Run("reads request arriving one byte at a time", func(t *testing.T) {
+		raw := "POST /slow HTTP/1.1\r\nContent-Length: 6\r\n\r\nfoobar"
+		reader := bufio.NewReader(iotest.OneByteReader(strings.NewReader(raw)))
+
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if string(req.Body) != "foobar" {
+			t.Errorf("expected body %q but got %q", "foobar", req.Body)
+		}
+	})
+
+	t.Run("returns error on truncated body", func(t *testing.T) {
+		raw := "POST /foo HTTP/1.1\r\nContent-Length: 10\r\n\r\nfoo"
+		_, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected io.ErrUnexpectedEOF but got %v", err)
+		}
+	})
+
+	t.Run("refuses body larger than the limit", func(t *testing.T) {
+		raw := "POST / HTTP/1.1\r\nContent-Length: 40000000000000\r\n\r\nfoo"
+		_, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err == nil || err.Error() != "request body is too large" {
+			t.Errorf("expected request body is too large error but got %v", err)
+		}
+	})
+
+	t.Run("refuses too many headers", func(t *testing.T) {
+		raw := "GET / HTTP/1.1\r\n" + strings.Repeat("X-Foo: bar\r\n", 101) + "\r\n"
+		_, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err == nil || err.Error() != "request headers are too large" {
+			t.Errorf("expected request headers are too large error but got %v", err)
+		}
+	})
+
+	t.Run("refuses headers larger than the limit", func(t *testing.T) {
+		raw := "GET / HTTP/1.1\r\n" + strings.Repeat("X-Foo: "+strings.Repeat("a", 1000)+"\r\n", 70) + "\r\n"
+		_, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err == nil || err.Error() != "request headers are too large" {
+			t.Errorf("expected request headers are too large error but got %v", err)
+		}
+	})
+
+	t.Run("reads header longer than the read buffer", func(t *testing.T) {
+		cookie := strings.Repeat("a", 5000)
+		raw := "GET / HTTP/1.1\r\nCookie: " + cookie + "\r\nHost: example.com\r\n\r\n"
+		req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+
+		if req.Headers.Get("Cookie") != cookie {
+			t.Errorf("expected Cookie header of %d bytes but got %d", len(cookie), len(req.Headers.Get("Cookie")))
+		}
+
+		if req.Headers.Get("Host") != "example.com" {
+			t.Errorf("expected Host header example.com but got %v", req.Headers.Get("Host"))
+		}
+	})
+
+	t.Run("refuses header line larger than the limit", func(t *testing.T) {
+		raw := "GET / HTTP/1.1\r\nCookie: " + strings.Repeat("a", 70*1024) + "\r\n\r\n"
+		_, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err == nil || err.Error() != "request headers are too large" {
+			t.Errorf("expected request headers are too large error but got %v", err)
+		}
+	})
+
+	t.Run("refuses request line larger than the limit", func(t *testing.T) {
+		raw := "GET /" + strings.Repeat("a", 70*1024) + " HTTP/1.1\r\n\r\n"
+		_, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err == nil || err.Error() != "request line is too long" {
+			t.Errorf("expected request line is too long error but got %v", err)
+		}
+	})
+
+	t.Run("returns error on truncated headers", func(t *testing.T) {
+		raw := "GET /foo HTTP/1.1\r\nHost: example.com\r\n"
+		_, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err == nil || err.Error() != "invalid end of headers" {
+			t.Errorf("expected invalid end of headers error but got %v", err)
+		}
+	})
+}
+
+func TestParseRequestHeaders(t *testing.T) {
+	raw := "GET / HTTP/1.1\r\nhost: example.com\r\nAccept: text/html\r\naccept: application/json\r\n\r\n"
+	req, err := http.ParseRequest([]byte(raw))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	if req.Headers.Get("Host") != "example.com" {
+		t.Errorf("expected Host header example.com but got %v", req.Headers.Get("Host"))
+	}
+
+	accept := req.Headers.Values("Accept")
+	if len(accept) != 2 || accept[0] != "text/html" || accept[1] != "application/json" {
+		t.Errorf("expected both Accept headers in order but got %v", accept)
+	}
+
+	t.Run("rejects conflicting Content-Length headers", func(t *testing.T) {
+		raw := "POST / HTTP/1.1\r\nContent-Length: 3\r\nContent-Length: 4\r\n\r\nfoob"
+		_, err := http.ParseRequest([]byte(raw))
+		if err == nil {
+			t.Errorf("expected error but got nil")
+		}
+	})
+}
+
+func TestParseRequestTarget(t *testing.T) {
+	var testCases = []struct {
+		description      string
+		target           string
+		expectedPath     string
+		expectedRawPath  string
+		expectedRawQuery string
+		expectedQuery    map[string][]string
+	}{
+		{
+			description:     "plain path",
+			target:          "/echo/foo",
+			expectedPath:    "/echo/foo",
+			expectedRawPath: "/echo/foo",
+			expectedQuery:   map[string][]string{},
+		},
+		{
+			description:      "path with query",
+			target:           "/echo/foo?x=1&y=2&x=3",
+			expectedPath:     "/echo/foo",
+			expectedRawPath:  "/echo/foo",
+			expectedRawQuery: "x=1&y=2&x=3",
+			expectedQuery:    map[string][]string{"x": {"1", "3"}, "y": {"2"}},
+		},
+		{
+			description:      "percent-encoded path and query",
+			target:           "/echo/hello%20world?q=a%26b",
+			expectedPath:     "/echo/hello world",
+			expectedRawPath:  "/echo/hello%20world",
+			expectedRawQuery: "q=a%26b",
+			expectedQuery:    map[string][]string{"q": {"a&b"}},
+		},
+		{
+			description:     "asterisk form",
+			target:          "*",
+			expectedPath:    "*",
+			expectedRawPath: "*",
+			expectedQuery:   map[string][]string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			raw := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: example.com\r\n\r\n", tc.target)
+			req, err := http.ParseRequest([]byte(raw))
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+
+			if req.Path != tc.expectedPath {
+				t.Errorf("expected %v path but got %v", tc.expectedPath, req.Path)
+			}
+
+			if req.RawPath != tc.expectedRawPath {
+				t.Errorf("expected %v raw path but got %v", tc.expectedRawPath, req.RawPath)
+			}
+
+			if req.RawQuery != tc.expectedRawQuery {
+				t.Errorf("expected %v raw query but got %v", tc.expectedRawQuery, req.RawQuery)
+			}
+
+			if len(req.Query) != len(tc.expectedQuery) {
+				t.Errorf("expected %v query parameters but got %v", len(tc.expectedQuery), len(req.Query))
+			}
+
+			for name, values := range tc.expectedQuery {
+				if !slices.Equal(req.Query[name], values) {
+					t.Errorf("expected %v query parameter to be %v but got %v", name, values, req.Query[name])
+				}
+			}
+		})
+	}
+
+	t.Run("invalid target", func(t *testing.T) {
+		_, err := http.ParseRequest([]byte("GET foo%zz HTTP/1.1\r\n\r\n"))
+		if err == nil {
+			t.Errorf("expected error but got nil")
+		}
+	})
+}
+
+func TestParamAccessors(t *testing.T) {
+	req := &http.Request{Params: map[string]string{"id": "42", "neg": "-1", "slug": "foo"}}
+
+	t.Run("ParamInt", func(t *testing.T) {
+		id, err := req.ParamInt("id")
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if id != 42 {
+			t.Errorf("expected 42 but got %v", id)
+		}
+
+		_, err = req.ParamInt("slug")
+		if err == nil || err.Error() != "path variable {slug} is not an integer: strconv.Atoi: parsing \"foo\": invalid syntax" {
+			t.Errorf("expected parse error but got %v", err)
+		}
+
+		_, err = req.ParamInt("missing")
+		if err == nil || err.Error() != "path variable {missing} is not set" {
+			t.Errorf("expected missing variable error but got %v", err)
+		}
+	})
+
+	t.Run("ParamUint", func(t *testing.T) {
+		id, err := req.ParamUint("id")
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if id != 42 {
+			t.Errorf("expected 42 but got %v", id)
+		}
+
+		_, err = req.ParamUint("neg")
+		if err == nil {
+			t.Errorf("expected error but got nil")
+		}
+	})
+}
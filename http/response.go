@@ -1,59 +1,554 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
 )
 
 const (
+	protocolVersion1_0 = "HTTP/1.0"
 	protocolVersion1_1 = "HTTP/1.1"
+
+	// body is automatically flushed to the connection once it grows beyond this size
+	respBufSize = 1024 * 32 // 32KB buffer
 )
 
 var (
-	statusMap = map[int]string{
-		200: "OK",
-		201: "Created",
-		404: "Not Found",
-	}
+	// ErrContentLength is returned by Write and Flush, and when the response
+	// is sent, for bytes of Body past the Content-Length set by the handler.
+	ErrContentLength = errors.New("response body is longer than its Content-Length")
+
+	errResponseFinished = errors.New("response is already finished")
 )
 
+// Response is built by handlers. Handlers may either set Body directly, in
+// which case the response is sent with a Content-Length header once the
+// handler returns, or stream the body with Write and Flush.
+//
+// The first Flush sends the status line and headers. If the handler has not
+// set Content-Length by then, the body is sent with "Transfer-Encoding: chunked"
+// and Trailers are sent after the last chunk, except to HTTP/1.0 clients which
+// get the body as is followed by the connection being closed. StatusCode and
+// Headers cannot be changed after the first Flush.
+//
+// A body sent with a Content-Length set by the handler must have that many
+// bytes. Bytes past it are not sent, and a body ending before it is an error
+// that closes the connection.
+//
+// Handlers may instead set BodyReader, i.e. to an *os.File, to have its
+// content streamed to the client once the handler returns. It is sent with
+// the Content-Length set by the handler, or chunked if there is none.
+//
+// Responses with a 1xx, 204 or 304 status code have no body: Write returns
+// ErrBodyNotAllowed and Body is not sent.
 type Response struct {
 	protocol string
 
+	// w is the connection the response is written to. It is nil for
+	// responses that are only serialised with Bytes.
+	w           *bufio.Writer
+	omitBody    bool // response to a HEAD request
+	wroteHeader bool
+	chunked     bool
+	finished    bool
+	bodySent    int64 // bytes of Body sent as is, which count against Content-Length
+
+	// requestProtocol is the protocol of the request, i.e. "HTTP/1.0", whose
+	// clients don't know chunked bodies
+	requestProtocol string
+
+	// encode is set by the compression middleware and called right before
+	// the headers are written. complete tells whether Body holds the whole
+	// body. It returns a writer encoding the body into w, after setting the
+	// headers of the encoding, or nil to send the body as is.
+	encode  func(w io.Writer, complete bool) bodyEncoder
+	encoder bodyEncoder
+
 	StatusCode int
-	Headers    map[string]string
+	Headers    Header
 	Body       []byte
+	Trailers   Header
+
+	// BodyReader is sent after Body, and closed once sent if it is an
+	// io.Closer. Files are sent without being copied to user space unless
+	// the body is compressed or the connection uses TLS.
+	BodyReader io.Reader
 }
 
 func NewResponse() *Response {
 	return &Response{
 		protocol: protocolVersion1_1,
 
-		Headers: make(map[string]string),
-		Body:    make([]byte, 0),
+		Body: make([]byte, 0),
+	}
+}
+
+// newConnResponse creates a response that is streamed to w.
+func newConnResponse(w *bufio.Writer) *Response {
+	resp := NewResponse()
+	resp.w = w
+
+	return resp
+}
+
+// Write appends p to the body. Once the buffered body grows beyond
+// respBufSize it is flushed to the connection.
+func (r *Response) Write(p []byte) (int, error) {
+	if r.finished {
+		return 0, errResponseFinished
+	}
+
+	if !bodyAllowed(r.StatusCode) {
+		return 0, ErrBodyNotAllowed
+	}
+
+	if r.wroteHeader {
+		length, declared := r.declaredLength()
+		if declared && r.bodySent+int64(len(r.Body)+len(p)) > length {
+			return 0, ErrContentLength
+		}
+	}
+
+	r.Body = append(r.Body, p...)
+
+	if r.w != nil && len(r.Body) >= respBufSize {
+		flushErr := r.Flush()
+		if flushErr != nil {
+			return 0, flushErr
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush sends the headers, if they haven't been sent yet, and the buffered
+// body to the client. It is a no-op for responses not bound to a connection.
+func (r *Response) Flush() error {
+	if r.w == nil {
+		return nil
+	}
+
+	if r.finished {
+		return errResponseFinished
+	}
+
+	if !r.wroteHeader {
+		statusErr := r.validateStatus()
+		if statusErr != nil {
+			return statusErr
+		}
+
+		r.writeStreamHeader()
+	}
+
+	writeErr := r.writeBody()
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if r.encoder != nil && !r.omitBody {
+		flushErr := r.encoder.Flush()
+		if flushErr != nil {
+			return flushErr
+		}
+	}
+
+	return r.w.Flush()
+}
+
+// writeStreamHeader writes the headers of a body whose length isn't known
+// yet, which is compressed or chunked unless the handler has set
+// Content-Length. HTTP/1.0 clients get the body as is instead of chunked,
+// and the connection is closed to tell them where it ends.
+func (r *Response) writeStreamHeader() {
+	closeDelimited := r.requestProtocol == protocolVersion1_0
+
+	r.detectContentType()
+	if r.encode != nil && bodyAllowed(r.StatusCode) {
+		var w io.Writer = chunkWriter{r.w}
+		if closeDelimited {
+			w = r.w
+		}
+		r.encoder = r.encode(w, false)
 	}
+
+	unframed := bodyAllowed(r.StatusCode) && !r.Headers.Has("Content-Length")
+	if unframed && closeDelimited {
+		r.Headers.Set("Connection", "close")
+	}
+
+	r.chunked = unframed && !closeDelimited
+	if r.chunked {
+		r.Headers.Set("Transfer-Encoding", "chunked")
+		if len(r.Trailers) > 0 {
+			r.Headers.Set("Trailer", strings.Join(r.Trailers.Names(), ", "))
+		}
+	}
+
+	r.writeHeader(r.w, "")
+	r.wroteHeader = true
+}
+
+// finish completes the response once the handler has returned. A response
+// that was never flushed and has no BodyReader is sent in one go with a
+// Content-Length header.
+func (r *Response) finish() error {
+	if r.finished {
+		return nil
+	}
+
+	if !r.wroteHeader {
+		statusErr := r.validateStatus()
+		if statusErr != nil {
+			r.closeBodyReader()
+			return statusErr
+		}
+
+		if r.BodyReader != nil {
+			r.writeStreamHeader()
+		} else {
+			encodeErr := r.encodeBody()
+			if encodeErr != nil {
+				return encodeErr
+			}
+
+			r.writeHeader(r.w, r.contentLength())
+			r.wroteHeader = true
+		}
+	}
+
+	writeErr := r.writeBody()
+	if writeErr != nil {
+		r.closeBodyReader()
+		return writeErr
+	}
+
+	if r.BodyReader != nil {
+		copyErr := r.writeBodyReader()
+		if copyErr != nil {
+			return copyErr
+		}
+	} else if length, declared := r.declaredLength(); declared && r.bodySent < length {
+		// the client would wait for the rest of the body
+		return io.ErrUnexpectedEOF
+	}
+
+	if r.encoder != nil && !r.omitBody {
+		closeErr := r.encoder.Close()
+		if closeErr != nil {
+			return closeErr
+		}
+	}
+
+	if r.chunked && !r.omitBody {
+		// last chunk followed by trailers
+		r.w.WriteString("0\r\n")
+		for _, field := range r.Trailers {
+			r.w.WriteString(fmt.Sprintf("%s: %s\r\n", field.Name, field.Value))
+		}
+		r.w.WriteString("\r\n")
+	}
+	r.finished = true
+
+	return r.w.Flush()
 }
 
 func (r *Response) Bytes() []byte {
 	var b bytes.Buffer
 
+	r.writeHeader(&b, r.contentLength())
+	if bodyAllowed(r.StatusCode) {
+		b.Write(r.Body)
+	}
+
+	return b.Bytes()
+}
+
+// contentLength returns the length of the buffered body, which is the
+// Content-Length of a response that has never been flushed. Responses
+// without a body get none.
+func (r *Response) contentLength() string {
+	if !bodyAllowed(r.StatusCode) {
+		return ""
+	}
+
+	return strconv.Itoa(len(r.Body))
+}
+
+// encodeBody encodes the whole body of a response that was never flushed, so
+// that it can still be sent with a Content-Length header.
+func (r *Response) encodeBody() error {
+	if r.encode == nil || !bodyAllowed(r.StatusCode) {
+		return nil
+	}
+
+	r.detectContentType()
+
+	var buf bytes.Buffer
+	encoder := r.encode(&buf, true)
+	if encoder == nil {
+		return nil
+	}
+
+	_, writeErr := encoder.Write(r.Body)
+	if writeErr != nil {
+		return fmt.Errorf("cannot encode response body: %w", writeErr)
+	}
+
+	closeErr := encoder.Close()
+	if closeErr != nil {
+		return fmt.Errorf("cannot encode response body: %w", closeErr)
+	}
+	r.Body = buf.Bytes()
+
+	return nil
+}
+
+// validateStatus returns an error if the status code set by the handler is
+// invalid. The zero value stands for 200.
+func (r *Response) validateStatus() error {
+	if r.StatusCode == 0 {
+		return nil
+	}
+
+	return validateStatus(r.StatusCode)
+}
+
+// reset discards the status, headers and body set by the handler and turns
+// the response into a plain text error response. The Connection header is
+// kept so that the connection is handled as the request asked for, and so
+// are the headers the server adds to every response.
+func (r *Response) reset(statusCode int) {
+	var headers Header
+	for _, name := range []string{"Date", "Server", "Connection"} {
+		value := r.Headers.Get(name)
+		if value != "" {
+			headers.Set(name, value)
+		}
+	}
+	r.Headers = headers
+
+	r.StatusCode = statusCode
+	r.Headers.Set("Content-Type", "text/plain")
+	r.Body = []byte(StatusText(statusCode))
+	r.Trailers = nil
+	r.closeBodyReader()
+}
+
+// detectContentType labels a body the handler didn't set a content type for,
+// judging by the part of the body buffered so far.
+func (r *Response) detectContentType() {
+	if len(r.Body) > 0 && bodyAllowed(r.StatusCode) && !r.Headers.Has("Content-Type") {
+		r.Headers.Set("Content-Type", DetectContentType(r.Body))
+	}
+}
+
+// writeHeader writes the status line and headers, in the order they were
+// added, followed by an empty line. contentLength is written as the last
+// header unless it is empty or the handler has set Content-Length itself.
+func (r *Response) writeHeader(w io.StringWriter, contentLength string) {
+	if r.StatusCode == 0 {
+		r.StatusCode = StatusOK
+	}
+
+	r.detectContentType()
+
 	// Write the status line
-	b.WriteString(fmt.Sprintf("%v %v\r\n", r.strProtocol(), r.strStatus()))
+	w.WriteString(fmt.Sprintf("%v %v\r\n", r.strProtocol(), r.strStatus()))
+
+	// Write headers. 1xx and 204 responses must not have framing headers
+	// since they never have a body; a 304 response may have them to describe
+	// the representation it stands for.
+	framed := r.StatusCode >= 200 && r.StatusCode != StatusNoContent
+	for _, field := range r.Headers {
+		if !framed && (strings.EqualFold(field.Name, "Content-Length") || strings.EqualFold(field.Name, "Transfer-Encoding")) {
+			continue
+		}
+
+		w.WriteString(fmt.Sprintf("%s: %s\r\n", field.Name, field.Value))
+	}
+	if contentLength != "" && !r.Headers.Has("Content-Length") {
+		w.WriteString(fmt.Sprintf("Content-Length: %s\r\n", contentLength))
+	}
+	w.WriteString("\r\n")
+}
+
+// writeBody writes the buffered body to the connection, as a single chunk
+// when the response is chunked, and empties the buffer.
+func (r *Response) writeBody() error {
+	if len(r.Body) == 0 {
+		return nil
+	}
 
-	// Write headers
-	for k, v := range r.Headers {
-		b.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+	// headers of a response to HEAD are the same as for GET, but the body
+	// is discarded, as is the body of a status code that doesn't allow one
+	if r.omitBody || !bodyAllowed(r.StatusCode) {
+		r.Body = r.Body[:0]
+		return nil
 	}
-	_, exists := r.Headers["Content-Length"]
-	if exists {
-		b.WriteString("\r\n")
+
+	var writeErr error
+	if r.encoder != nil {
+		// the encoder frames its output itself
+		_, writeErr = r.encoder.Write(r.Body)
+	} else if r.chunked {
+		r.w.WriteString(fmt.Sprintf("%x\r\n", len(r.Body)))
+		r.w.Write(r.Body)
+		_, writeErr = r.w.WriteString("\r\n")
 	} else {
-		b.WriteString(fmt.Sprintf("Content-Length: %d\r\n\r\n", len(r.Body)))
+		body := r.Body
+		length, declared := r.declaredLength()
+		if declared && r.bodySent+int64(len(body)) > length {
+			body = body[:max(length-r.bodySent, 0)]
+			writeErr = ErrContentLength
+		}
+
+		n, bodyErr := r.w.Write(body)
+		r.bodySent += int64(n)
+		if bodyErr != nil {
+			writeErr = bodyErr
+		}
 	}
+	r.Body = r.Body[:0]
 
-	b.WriteString(string(r.Body))
+	return writeErr
+}
 
-	return b.Bytes()
+// declaredLength returns the Content-Length set by the handler, which the
+// body must match when it is sent as is. declared is false when there is no
+// body to send; compressed and chunked bodies have no Content-Length.
+func (r *Response) declaredLength() (length int64, declared bool) {
+	if r.omitBody || !bodyAllowed(r.StatusCode) || !r.Headers.Has("Content-Length") {
+		return 0, false
+	}
+
+	length, parseErr := strconv.ParseInt(r.Headers.Get("Content-Length"), 10, 64)
+	if parseErr != nil {
+		return 0, false
+	}
+
+	return length, true
+}
+
+// writeBodyReader streams BodyReader to the connection, through the encoder
+// or as chunks if needed, and closes it. Otherwise the content goes straight
+// to the connection, which lets it use sendfile.
+func (r *Response) writeBodyReader() error {
+	defer r.closeBodyReader()
+
+	if r.omitBody || !bodyAllowed(r.StatusCode) {
+		return nil
+	}
+
+	if r.encoder != nil {
+		_, copyErr := io.Copy(r.encoder, r.BodyReader)
+		return copyErr
+	}
+
+	if r.chunked {
+		_, copyErr := io.Copy(chunkWriter{r.w}, r.BodyReader)
+		return copyErr
+	}
+
+	flushErr := r.w.Flush()
+	if flushErr != nil {
+		return flushErr
+	}
+
+	length, declared := r.declaredLength()
+	if !declared {
+		// the body ends when the connection is closed
+		_, copyErr := io.Copy(r.w, r.BodyReader)
+		return copyErr
+	}
+
+	// a body shorter than announced would leave the client waiting for the
+	// rest, and a longer one would be taken for the next response
+	lw := &lengthWriter{w: r.w, n: length - r.bodySent}
+	_, copyErr := io.Copy(lw, r.BodyReader)
+	if copyErr != nil {
+		return copyErr
+	}
+	if lw.n > 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+func (r *Response) closeBodyReader() {
+	closer, ok := r.BodyReader.(io.Closer)
+	if ok {
+		closer.Close()
+	}
+	r.BodyReader = nil
+}
+
+// bodyEncoder compresses a streamed body. Flush sends what was compressed so
+// far and Close the rest.
+type bodyEncoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// lengthWriter writes the first n bytes written to it to w and discards the
+// rest. ReadFrom hands limited readers, i.e. of files, to w as they are, so
+// that they are still sent with sendfile.
+type lengthWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (lw *lengthWriter) Write(p []byte) (int, error) {
+	size := len(p)
+	if int64(size) > lw.n {
+		p = p[:max(lw.n, 0)]
+	}
+
+	n, writeErr := lw.w.Write(p)
+	lw.n -= int64(n)
+	if writeErr != nil {
+		return n, writeErr
+	}
+
+	return size, nil
+}
+
+func (lw *lengthWriter) ReadFrom(src io.Reader) (int64, error) {
+	limited, isLimited := src.(*io.LimitedReader)
+	if !isLimited || limited.N > lw.n {
+		limited = &io.LimitedReader{R: src, N: max(lw.n, 0)}
+	}
+
+	n, copyErr := lw.w.ReadFrom(limited)
+	lw.n -= n
+
+	return n, copyErr
+}
+
+// chunkWriter writes every write to w as a chunk.
+type chunkWriter struct {
+	w *bufio.Writer
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	cw.w.WriteString(fmt.Sprintf("%x\r\n", len(p)))
+	cw.w.Write(p)
+	_, writeErr := cw.w.WriteString("\r\n")
+	if writeErr != nil {
+		return 0, writeErr
+	}
+
+	return len(p), nil
 }
 
 func (r *Response) strProtocol() string {
@@ -64,11 +559,8 @@ func (r *Response) strProtocol() string {
 	return r.protocol
 }
 
+// strStatus returns the status code and its reason phrase. The reason phrase
+// of an unregistered code is empty, but the space before it is still required.
 func (r *Response) strStatus() string {
-	strStatus, exists := statusMap[r.StatusCode]
-	if exists {
-		return fmt.Sprintf("%d %s", r.StatusCode, strStatus)
-	}
-
-	return fmt.Sprintf("%d", r.StatusCode)
+	return fmt.Sprintf("%d %s", r.StatusCode, StatusText(r.StatusCode))
 }
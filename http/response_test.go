@@ -1,7 +1,12 @@
 package http_test
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/codecrafters-io/http-server-starter-go/http"
@@ -24,8 +29,9 @@ func TestBytes(t *testing.T) {
 			description: "response with 204 status code with body",
 			response: &http.Response{
 				StatusCode: 204,
+				Body:       []byte("dropped"),
 			},
-			expectedBytes: []byte("HTTP/1.1 204\r\nContent-Length: 0\r\n\r\n"),
+			expectedBytes: []byte("HTTP/1.1 204 No Content\r\n\r\n"),
 		},
 		{
 			description: "response with 200 status code with body",
@@ -33,16 +39,55 @@ func TestBytes(t *testing.T) {
 				StatusCode: 200,
 				Body:       []byte("Hello, World!"),
 			},
-			expectedBytes: []byte("HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\nHello, World!"),
+			expectedBytes: []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: 13\r\n\r\nHello, World!"),
 		},
 		{
 			description: "response with 202 status code with JSON body",
 			response: &http.Response{
 				StatusCode: 202,
-				Headers:    map[string]string{"Content-Type": "application/json"},
+				Headers:    http.Header{{Name: "Content-Type", Value: "application/json"}},
 				Body:       []byte(`{"message":"accepted"}`),
 			},
-			expectedBytes: []byte("HTTP/1.1 202\r\nContent-Type: application/json\r\nContent-Length: 22\r\n\r\n{\"message\":\"accepted\"}"),
+			expectedBytes: []byte("HTTP/1.1 202 Accepted\r\nContent-Type: application/json\r\nContent-Length: 22\r\n\r\n{\"message\":\"accepted\"}"),
+		},
+		{
+			description: "response with 304 status code keeps Content-Length set by the handler",
+			response: &http.Response{
+				StatusCode: 304,
+				Headers:    http.Header{{Name: "Content-Length", Value: "13"}},
+			},
+			expectedBytes: []byte("HTTP/1.1 304 Not Modified\r\nContent-Length: 13\r\n\r\n"),
+		},
+		{
+			description: "response with 101 status code drops framing headers",
+			response: &http.Response{
+				StatusCode: 101,
+				Headers: http.Header{
+					{Name: "Upgrade", Value: "websocket"},
+					{Name: "Content-Length", Value: "0"},
+				},
+			},
+			expectedBytes: []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n"),
+		},
+		{
+			description: "response with unregistered status code has an empty reason phrase",
+			response: &http.Response{
+				StatusCode: 299,
+			},
+			expectedBytes: []byte("HTTP/1.1 299 \r\nContent-Length: 0\r\n\r\n"),
+		},
+		{
+			description: "response with repeated headers keeps their order",
+			response: &http.Response{
+				StatusCode: 200,
+				Headers: http.Header{
+					{Name: "Set-Cookie", Value: "a=1"},
+					{Name: "Content-Type", Value: "text/plain"},
+					{Name: "Set-Cookie", Value: "b=2"},
+				},
+			},
+			expectedBytes: []byte("HTTP/1.1 200 OK\r\nSet-Cookie: a=1\r\nContent-Type: text/plain\r\n" +
+				"Set-Cookie: b=2\r\nContent-Length: 0\r\n\r\n"),
 		},
 	}
 
@@ -55,3 +100,360 @@ func TestBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamingResponse(t *testing.T) {
+	t.Run("response that is never flushed is sent with Content-Length", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.StatusCode = http.StatusOK
+		resp.Write([]byte("Hello, "))
+		resp.Write([]byte("World!"))
+		err := resp.Finish()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: 13\r\n\r\nHello, World!"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("flushed response without Content-Length is chunked", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.StatusCode = http.StatusOK
+		resp.Write([]byte("Wiki"))
+		err := resp.Flush()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expectedHead := "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nWiki\r\n"
+		if buf.String() != expectedHead {
+			t.Errorf("expected %q after flush, got %q", expectedHead, buf.String())
+		}
+
+		resp.Write([]byte("pedia"))
+		err = resp.Finish()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := expectedHead + "5\r\npedia\r\n0\r\n\r\n"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("chunked response with trailers", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.Trailers.Set("Checksum", "")
+		resp.Write([]byte("foo"))
+		resp.Flush()
+		resp.Trailers.Set("Checksum", "abc")
+		resp.Finish()
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nTransfer-Encoding: chunked\r\nTrailer: Checksum\r\n\r\n" +
+			"3\r\nfoo\r\n0\r\nChecksum: abc\r\n\r\n"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("flushed response with Content-Length is not chunked", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.Headers.Set("Content-Length", "6")
+		resp.Write([]byte("foo"))
+		resp.Flush()
+		resp.Write([]byte("bar"))
+		resp.Finish()
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Length: 6\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nfoobar"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("large body is flushed automatically", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.Write(bytes.Repeat([]byte("a"), 64*1024))
+
+		if !strings.Contains(buf.String(), "Transfer-Encoding: chunked") {
+			t.Errorf("expected response to be flushed as chunked, got %q", buf.String())
+		}
+
+		err := resp.Finish()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !strings.HasSuffix(buf.String(), "0\r\n\r\n") {
+			t.Errorf("expected response to end with the last chunk")
+		}
+	})
+	t.Run("body reader with Content-Length is sent as is", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		body := &closeRecorder{Reader: strings.NewReader("Hello, World!")}
+		resp := http.NewConnResponse(w)
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Headers.Set("Content-Length", "13")
+		resp.BodyReader = body
+		err := resp.Finish()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 13\r\n\r\nHello, World!"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+
+		if !body.closed {
+			t.Errorf("expected body reader to be closed")
+		}
+	})
+
+	t.Run("write past Content-Length is an error", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Headers.Set("Content-Length", "3")
+		err := resp.Flush()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		_, err = resp.Write([]byte("hello world"))
+		if !errors.Is(err, http.ErrContentLength) {
+			t.Errorf("expected ErrContentLength, got %v", err)
+		}
+
+		_, err = resp.Write([]byte("hey"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		err = resp.Finish()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 3\r\n\r\nhey"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("body longer than Content-Length is cut", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Headers.Set("Content-Length", "3")
+		resp.Body = []byte("hello world")
+		err := resp.Finish()
+		if !errors.Is(err, http.ErrContentLength) {
+			t.Errorf("expected ErrContentLength, got %v", err)
+		}
+		w.Flush()
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 3\r\n\r\nhel"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("body shorter than Content-Length is an error", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Headers.Set("Content-Length", "10")
+		resp.Write([]byte("hello"))
+		err := resp.Finish()
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+		}
+	})
+
+	t.Run("body reader shorter than Content-Length is an error", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		body := &closeRecorder{Reader: strings.NewReader("Hello")}
+		resp := http.NewConnResponse(w)
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Headers.Set("Content-Length", "13")
+		resp.BodyReader = body
+		err := resp.Finish()
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+		}
+
+		if !body.closed {
+			t.Errorf("expected body reader to be closed")
+		}
+	})
+
+	t.Run("body reader longer than Content-Length is cut", func(t *testing.T) {
+		// with and without WriteTo, so that both the Write and ReadFrom
+		// paths of the copy are taken
+		readers := map[string]func() io.Reader{
+			"WriterTo":     func() io.Reader { return strings.NewReader(", World! and more") },
+			"not WriterTo": func() io.Reader { return struct{ io.Reader }{strings.NewReader(", World! and more")} },
+		}
+
+		for name, newReader := range readers {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+
+			resp := http.NewConnResponse(w)
+			resp.Headers.Set("Content-Type", "text/plain")
+			resp.Headers.Set("Content-Length", "13")
+			resp.Body = []byte("Hello")
+			resp.BodyReader = newReader()
+			err := resp.Finish()
+			if err != nil {
+				t.Fatalf("%v: expected no error, got %v", name, err)
+			}
+
+			expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 13\r\n\r\nHello, World!"
+			if buf.String() != expected {
+				t.Errorf("%v: expected %q, got %q", name, expected, buf.String())
+			}
+		}
+	})
+
+	t.Run("body reader without Content-Length is chunked", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.BodyReader = strings.NewReader("Wikipedia")
+		err := resp.Finish()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n9\r\nWikipedia\r\n0\r\n\r\n"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("body reader of a response without body is closed", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		body := &closeRecorder{Reader: strings.NewReader("foo")}
+		resp := http.NewConnResponse(w)
+		resp.StatusCode = http.StatusNotModified
+		resp.BodyReader = body
+		err := resp.Finish()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := "HTTP/1.1 304 Not Modified\r\n\r\n"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+
+		if !body.closed {
+			t.Errorf("expected body reader to be closed")
+		}
+	})
+
+	t.Run("body is not allowed for 204", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+
+		resp := http.NewConnResponse(w)
+		resp.StatusCode = http.StatusNoContent
+		_, err := resp.Write([]byte("foo"))
+		if !errors.Is(err, http.ErrBodyNotAllowed) {
+			t.Errorf("expected ErrBodyNotAllowed, got %v", err)
+		}
+
+		err = resp.Flush()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		resp.Finish()
+
+		expected := "HTTP/1.1 204 No Content\r\n\r\n"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("invalid status code is rejected", func(t *testing.T) {
+		for _, code := range []int{-1, 99, 600, 1000} {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+
+			resp := http.NewConnResponse(w)
+			resp.StatusCode = code
+			err := resp.Flush()
+			if err == nil || err.Error() != fmt.Sprintf("invalid status code %d", code) {
+				t.Errorf("expected invalid status code error for %d, got %v", code, err)
+			}
+
+			if buf.Len() != 0 {
+				t.Errorf("expected nothing to be written for %d, got %q", code, buf.String())
+			}
+		}
+	})
+}
+
+func TestStatusText(t *testing.T) {
+	var testCases = []struct {
+		code     int
+		expected string
+	}{
+		{code: http.StatusOK, expected: "OK"},
+		{code: http.StatusContentTooLarge, expected: "Content Too Large"},
+		{code: http.StatusNetworkAuthenticationRequired, expected: "Network Authentication Required"},
+		{code: 299, expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.code), func(t *testing.T) {
+			if http.StatusText(tc.code) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, http.StatusText(tc.code))
+			}
+		})
+	}
+}
+
+// closeRecorder records whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
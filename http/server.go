@@ -1,31 +1,119 @@
 package http
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	reqTmpBufInKB = 1024 * 4 // 4KB buffer
+
+	// how often Shutdown checks whether all connections became idle
+	shutdownPollInterval = 50 * time.Millisecond
+
+	// how long responding 503 to a rejected connection may take
+	rejectTimeout = time.Second
+
+	defaultRetryAfter = time.Second
+
+	// how much of a streamed body is sent to the connection at once, each
+	// piece getting the whole WriteTimeout
+	sendPieceSize = 1024 * 1024 // 1MB
+)
+
+var (
+	// ErrServerClosed is returned by Start after Stop or Shutdown is called.
+	ErrServerClosed = errors.New("server closed")
+)
+
+// connState tells whether a connection is waiting for a request (idle) or is
+// reading, handling or responding to one (active).
+type connState int
+
+const (
+	stateIdle connState = iota
+	stateActive
 )
 
 type Server struct {
-	running  bool
-	logger   *slog.Logger
+	logger     *slog.Logger
+	inShutdown atomic.Bool
+
+	mu       sync.Mutex
 	listener net.Listener
+	conns    map[net.Conn]connState
+	ipConns  map[string]int
+
+	// connSlots holds a value per connection being served when MaxConns is set
+	connSlots chan struct{}
 
 	Address string
 	Handler *Mux
 	Created chan bool
+
+	// Timeouts applied to every connection. Zero means no timeout.
+	//
+	// ReadHeaderTimeout is how long a client has to send the request line and
+	// headers once the first byte of a request arrives, and ReadBodyTimeout is
+	// how long it then has to send the body. WriteTimeout limits every single
+	// write to the connection rather than the whole response, so that large
+	// responses can still be streamed to healthy clients. IdleTimeout is how
+	// long a keep-alive connection may wait for the next request; a new
+	// connection only gets ReadHeaderTimeout to start its first one.
+	ReadHeaderTimeout time.Duration
+	ReadBodyTimeout   time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// MaxConns limits the number of connections served at the same time. Once
+	// it is reached the server stops accepting connections until one of them
+	// is closed or, when RejectOverLimit is set, accepts them only to respond
+	// 503 Service Unavailable. MaxConnsPerIP limits the connections from a
+	// single remote IP; connections over that limit are always answered with
+	// 503. Zero means no limit.
+	MaxConns        int
+	MaxConnsPerIP   int
+	RejectOverLimit bool
+
+	// RetryAfter is sent in the Retry-After header of 503 responses to
+	// rejected connections. Defaults to 1 second.
+	RetryAfter time.Duration
+
+	// MaxBodySize is the largest request body accepted, in bytes. Larger
+	// bodies are refused with 413 Content Too Large. Defaults to
+	// DefaultMaxBodySize.
+	MaxBodySize int64
+
+	// ServerHeader is sent in the Server header of every response unless it
+	// is empty.
+	ServerHeader string
+
+	// Certificates switches the server to HTTPS. The first certificate is
+	// used for clients that don't ask for a server name matching any of the
+	// others.
+	Certificates []CertificateFiles
 }
 
 func NewServer(address string, handler *Mux, logger *slog.Logger) (*Server, error) {
 	return &Server{
 		logger: logger,
 
+		conns:   make(map[net.Conn]connState),
+		ipConns: make(map[string]int),
+
 		Address: address,
 		Handler: handler,
 		Created: make(chan bool, 1),
@@ -33,101 +121,395 @@ func NewServer(address string, handler *Mux, logger *slog.Logger) (*Server, erro
 }
 
 func (s *Server) Start() error {
-	var listenErr error
-	s.listener, listenErr = net.Listen("tcp", s.Address)
+	listener, listenErr := net.Listen("tcp", s.Address)
 	if listenErr != nil {
 		return fmt.Errorf("cannot start tcp server on %v: %w", s.Address, listenErr)
 	}
 
+	if len(s.Certificates) > 0 {
+		store, storeErr := newCertStore(s.Certificates, s.logger)
+		if storeErr != nil {
+			listener.Close()
+			return fmt.Errorf("cannot load TLS certificates: %w", storeErr)
+		}
+
+		listener = tls.NewListener(listener, store.tlsConfig())
+	}
+
+	s.mu.Lock()
+	// Stop or Shutdown may have run before there was a listener to close
+	if s.inShutdown.Load() {
+		s.mu.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
 	s.Created <- true
-	s.running = true
 
 	defer func() {
-		err := s.listener.Close()
-		if err != nil {
+		err := listener.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			s.logger.Error("error closing listener", "error", err)
 		}
 
 		s.logger.Info("server is stopped")
 	}()
 
+	if s.MaxConns > 0 {
+		s.connSlots = make(chan struct{}, s.MaxConns)
+	}
+
 	for {
-		if !s.running {
-			s.logger.Info("server is stopping...")
-			return nil
+		// Backpressure: don't accept connections until there is a free slot.
+		// Pending connections wait in the listen backlog of the kernel.
+		if s.connSlots != nil && !s.RejectOverLimit {
+			s.connSlots <- struct{}{}
 		}
 
-		conn, acceptErr := s.listener.Accept()
+		conn, acceptErr := listener.Accept()
 		if acceptErr != nil {
+			if !s.RejectOverLimit {
+				s.releaseSlot()
+			}
+
+			if s.inShutdown.Load() {
+				s.logger.Info("server is stopping...")
+				return ErrServerClosed
+			}
+
 			return fmt.Errorf("error accepting connection: %w", acceptErr)
 		}
 
-		// TODO: limit the number of goroutines
-		go s.handleConnection(conn)
+		if s.connSlots != nil && s.RejectOverLimit {
+			select {
+			case s.connSlots <- struct{}{}:
+			default:
+				go s.rejectConnection(conn, "too many connections")
+				continue
+			}
+		}
+
+		if !s.acquireIP(conn) {
+			s.releaseSlot()
+			go s.rejectConnection(conn, "too many connections from remote IP")
+			continue
+		}
+
+		go func() {
+			defer s.releaseSlot()
+			defer s.releaseIP(conn)
+
+			s.handleConnection(conn)
+		}()
+	}
+}
+
+// acquireIP counts conn against the limit of its remote IP and reports
+// whether it may be served.
+func (s *Server) acquireIP(conn net.Conn) bool {
+	if s.MaxConnsPerIP <= 0 {
+		return true
+	}
+
+	ip := remoteIP(conn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ipConns[ip] >= s.MaxConnsPerIP {
+		return false
+	}
+	s.ipConns[ip]++
+
+	return true
+}
+
+func (s *Server) releaseIP(conn net.Conn) {
+	if s.MaxConnsPerIP <= 0 {
+		return
+	}
+
+	ip := remoteIP(conn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ipConns[ip]--
+	if s.ipConns[ip] <= 0 {
+		delete(s.ipConns, ip)
+	}
+}
+
+func (s *Server) releaseSlot() {
+	if s.connSlots == nil {
+		return
+	}
+
+	select {
+	case <-s.connSlots:
+	default:
+	}
+}
+
+// rejectConnection responds 503 Service Unavailable to a connection that is
+// over one of the limits and closes it. The connection gets a short deadline
+// (which also covers the TLS handshake) so that rejected connections don't
+// pile up.
+func (s *Server) rejectConnection(conn net.Conn, reason string) {
+	defer conn.Close()
+
+	s.logger.Warn("rejecting connection", "reason", reason, "remote_addr", conn.RemoteAddr().String())
+
+	retryAfter := s.RetryAfter
+	if retryAfter == 0 {
+		retryAfter = defaultRetryAfter
+	}
+
+	resp := s.newResponse(nil)
+	resp.StatusCode = StatusServiceUnavailable
+	resp.Headers.Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+	resp.Headers.Set("Connection", "close")
+
+	conn.SetDeadline(time.Now().Add(rejectTimeout))
+	_, writeErr := conn.Write(resp.Bytes())
+	if writeErr != nil {
+		s.logger.Error("error writing response", "error", writeErr)
 	}
 }
 
+// Stop immediately closes the listener and all connections, including the
+// ones in the middle of handling a request. Use Shutdown to stop gracefully.
 func (s *Server) Stop() error {
+	s.inShutdown.Store(true)
+
+	err := s.closeListener()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	s.mu.Unlock()
+
+	return err
+}
+
+// Shutdown stops the server without interrupting in-flight requests. It closes
+// the listener, then closes connections as soon as they become idle and waits
+// until there are none left. If ctx expires first, the remaining connections
+// are closed forcefully and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+
+	closeErr := s.closeListener()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() {
+			return closeErr
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Warn("shutdown timed out, closing active connections")
+			s.Stop()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) closeListener() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+
 	err := s.listener.Close()
-	if err != nil {
+	if err != nil && !errors.Is(err, net.ErrClosed) {
 		return fmt.Errorf("error closing listener: %w", err)
 	}
 
 	return nil
 }
 
+// closeIdleConns closes the connections waiting for a new request and reports
+// whether all connections are closed.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, state := range s.conns {
+		if state == stateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+
+	return len(s.conns) == 0
+}
+
+// setConnState records the state of conn and reports whether conn may keep
+// serving requests; that is not the case for idle connections once the
+// server is shutting down.
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state == stateIdle && s.inShutdown.Load() {
+		return false
+	}
+
+	s.conns[conn] = state
+
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+}
+
 func (s *Server) handleConnection(conn net.Conn) {
 	defer s.closeConnection(conn)
+	// A panic outside of a handler leaves the connection in an unknown
+	// state, so it is only logged before the connection is closed.
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			s.logger.Error("panic serving connection", "panic", recovered,
+				"remote_addr", conn.RemoteAddr().String(), "stack", string(debug.Stack()))
+		}
+	}()
 
 	s.logger.Info("new connection", "remote_addr", conn.RemoteAddr().String())
 
+	// The handshake of a TLS connection counts as reading the first request's header.
+	tlsConn, isTLS := conn.(*tls.Conn)
+	if isTLS {
+		conn.SetDeadline(deadline(s.ReadHeaderTimeout))
+		handshakeErr := tlsConn.Handshake()
+		if handshakeErr != nil {
+			s.logger.Warn("TLS handshake failed", "error", handshakeErr, "remote_addr", conn.RemoteAddr().String())
+			return
+		}
+		conn.SetDeadline(time.Time{})
+	}
+
 	// Connection is only closed when one of the following cases happens:
-	// - server is told to stop
+	// - server is told to stop, after the in-flight request is responded to
 	// - client sends EOF
 	// - conn.Read returns an error
 	// - cannot parse request
 	// - "Connection: close" header is present in the request
 	// Otherwise connection is re-used.
+	//
+	// The reader is kept for the whole lifetime of the connection so that bytes
+	// of a pipelined request that were read together with the previous one are
+	// not lost.
+	reader := bufio.NewReaderSize(conn, reqTmpBufInKB)
+	writer := bufio.NewWriterSize(&timeoutWriter{conn: conn, timeout: s.WriteTimeout}, respBufSize)
+	// silent new connections are dropped as fast as slow requests, otherwise
+	// they would hold their slot for the whole IdleTimeout
+	waitTimeout := s.ReadHeaderTimeout
+	if waitTimeout == 0 {
+		waitTimeout = s.IdleTimeout
+	}
 	for {
 		// Stop handling requests when server is told to stop
-		if !s.running {
+		if !s.setConnState(conn, stateIdle) {
 			return
 		}
 
-		var requestData []byte
+		// Wait for the first byte of the next request while the connection
+		// is idle, so that Shutdown can close it in the meantime.
+		conn.SetReadDeadline(deadline(waitTimeout))
+		_, peekErr := reader.Peek(1)
+		if peekErr != nil {
+			if errors.Is(peekErr, os.ErrDeadlineExceeded) {
+				s.logger.Info("idle connection timed out")
+			} else {
+				s.logReadError(peekErr)
+			}
 
-		for {
-			var reqBuf = make([]byte, reqTmpBufInKB)
-			n, readErr := conn.Read(reqBuf)
-			if readErr != nil {
-				if errors.Is(readErr, io.EOF) {
-					s.logger.Info("connection closed by client")
-				} else {
-					s.logger.Error("error reading request", "error", readErr)
-				}
+			return
+		}
+		s.setConnState(conn, stateActive)
 
-				return
+		conn.SetReadDeadline(deadline(s.ReadHeaderTimeout))
+		req, readErr := readRequestHead(reader)
+		if readErr == nil {
+			conn.SetReadDeadline(deadline(s.ReadBodyTimeout))
+			readErr = readRequestBody(reader, req, s.maxBodySize())
+		}
+		if readErr != nil {
+			switch {
+			case errors.Is(readErr, os.ErrDeadlineExceeded):
+				s.logger.Warn("timed out reading request", "remote_addr", conn.RemoteAddr().String())
+				s.writeErrorResponse(writer, StatusRequestTimeout)
+			case errors.Is(readErr, errRequestBodyTooLarge):
+				s.logger.Warn("refusing request", "error", readErr, "remote_addr", conn.RemoteAddr().String())
+				s.writeErrorResponse(writer, StatusContentTooLarge)
+			case errors.Is(readErr, errHeadersTooLarge):
+				s.logger.Warn("refusing request", "error", readErr, "remote_addr", conn.RemoteAddr().String())
+				s.writeErrorResponse(writer, StatusRequestHeaderFieldsTooLarge)
+			case errors.Is(readErr, errRequestLineTooLong):
+				s.logger.Warn("refusing request", "error", readErr, "remote_addr", conn.RemoteAddr().String())
+				s.writeErrorResponse(writer, StatusURITooLong)
+			case isConnError(readErr):
+				s.logReadError(readErr)
+			default:
+				s.logger.Warn("malformed request", "error", readErr, "remote_addr", conn.RemoteAddr().String())
+				s.writeErrorResponse(writer, StatusBadRequest)
 			}
 
-			requestData = append(requestData, reqBuf[:n]...)
-			if n < len(reqBuf) {
-				break
-			}
+			return
 		}
+		conn.SetReadDeadline(time.Time{})
 
-		req, parseReqErr := ParseRequest(requestData)
-		if parseReqErr != nil {
-			s.logger.Error("error parsing request", "error", parseReqErr)
+		// Handle request and write response
+		resp := s.newResponse(writer)
+		resp.omitBody = req.Method == "HEAD"
+		resp.requestProtocol = req.Protocol
+		if !s.handleRequest(req, resp) {
+			// part of the response was sent already, the client can only
+			// tell that it is incomplete by the connection being closed
+			resp.closeBodyReader()
 			return
 		}
 
-		// Handle request and write response
-		resp := NewResponse()
-		s.Handler.HandleRequest(req, resp)
-		conn.Write(resp.Bytes())
+		if !resp.wroteHeader {
+			statusErr := resp.validateStatus()
+			if statusErr != nil {
+				s.logger.Error("invalid response", "error", statusErr, "method", req.Method, "path", req.Path)
+				resp.reset(StatusInternalServerError)
+			}
+		}
+
+		// Tell the client not to send further requests on this connection.
+		if s.inShutdown.Load() && !resp.wroteHeader {
+			resp.Headers.Set("Connection", "close")
+		}
+
+		finishErr := resp.finish()
+		if finishErr != nil {
+			s.logger.Error("error writing response", "error", finishErr)
+			// the client tells what is missing by the connection being closed
+			writer.Flush()
+			return
+		}
 
 		// Don't close TCP connection; waiting for new requests from the same connection.
-		if resp.Headers["Connection"] != "close" {
+		if !strings.EqualFold(resp.Headers.Get("Connection"), "close") {
+			waitTimeout = s.IdleTimeout
 			continue
 		}
 
@@ -135,13 +517,174 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 }
 
+// newResponse creates a response written to w, or serialised with Bytes if
+// w is nil, with the headers the server adds to every response. Handlers may
+// change or remove them.
+func (s *Server) newResponse(w *bufio.Writer) *Response {
+	resp := newConnResponse(w)
+	resp.Headers.Set("Date", httpDate())
+	if s.ServerHeader != "" {
+		resp.Headers.Set("Server", s.ServerHeader)
+	}
+
+	return resp
+}
+
+// handleRequest calls the handler, recovering from a panic in it. If the
+// handler panics before headers were sent, the response is replaced with a
+// 500 response. Otherwise handleRequest returns false and the connection
+// must be closed.
+func (s *Server) handleRequest(req *Request, resp *Response) (ok bool) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+
+		s.logger.Error("panic serving request", "panic", recovered,
+			"method", req.Method, "path", req.Path, "stack", string(debug.Stack()))
+
+		if resp.wroteHeader {
+			ok = false
+			return
+		}
+
+		resp.reset(StatusInternalServerError)
+		ok = true
+	}()
+
+	s.Handler.HandleRequest(req, resp)
+
+	return true
+}
+
+func (s *Server) logReadError(err error) {
+	if errors.Is(err, io.EOF) {
+		s.logger.Info("connection closed by client")
+	} else if errors.Is(err, net.ErrClosed) {
+		s.logger.Info("connection closed by server")
+	} else {
+		s.logger.Error("error reading request", "error", err)
+	}
+}
+
+// isConnError tells whether reading a request failed because of the
+// connection, i.e. it was closed or reset, rather than because the request is
+// malformed.
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || errors.As(err, &netErr)
+}
+
+// writeErrorResponse tells a client whose request could not be read, i.e.
+// because it was too slow sending it, that the connection is about to be
+// closed.
+func (s *Server) writeErrorResponse(w *bufio.Writer, statusCode int) {
+	resp := s.newResponse(w)
+	resp.StatusCode = statusCode
+	resp.Headers.Set("Connection", "close")
+
+	err := resp.finish()
+	if err != nil {
+		s.logger.Error("error writing response", "error", err)
+	}
+}
+
 func (s *Server) closeConnection(conn net.Conn) {
 	if conn == nil {
 		return
 	}
 
+	s.removeConn(conn)
+
 	closeErr := conn.Close()
-	if closeErr != nil {
+	if closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
 		s.logger.Error("error closing connection", "error", closeErr)
 	}
 }
+
+// timeoutWriter extends the write deadline of conn before every write.
+type timeoutWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	if w.timeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	}
+
+	return w.conn.Write(p)
+}
+
+// ReadFrom copies src to conn, which uses sendfile when src is a file and
+// conn a TCP connection. src is sent in pieces so that the write deadline is
+// extended for each of them.
+func (w *timeoutWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.timeout == 0 {
+		return io.Copy(w.conn, src)
+	}
+
+	// unwrap a limited reader so that the pieces read from the file itself,
+	// which sendfile requires
+	remaining := int64(-1)
+	limited, isLimited := src.(*io.LimitedReader)
+	if isLimited {
+		src, remaining = limited.R, max(limited.N, 0)
+	}
+
+	var written int64
+	for remaining != 0 {
+		piece := int64(sendPieceSize)
+		if remaining > 0 {
+			piece = min(piece, remaining)
+		}
+
+		w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+		n, copyErr := io.CopyN(w.conn, src, piece)
+		written += n
+		if remaining > 0 {
+			remaining -= n
+		}
+		if isLimited {
+			limited.N = remaining
+		}
+
+		if errors.Is(copyErr, io.EOF) {
+			break
+		}
+		if copyErr != nil {
+			return written, copyErr
+		}
+	}
+
+	return written, nil
+}
+
+func (s *Server) maxBodySize() int64 {
+	if s.MaxBodySize == 0 {
+		return DefaultMaxBodySize
+	}
+
+	return s.MaxBodySize
+}
+
+// deadline returns the deadline for an operation starting now, or the zero
+// time (no deadline) when timeout is zero.
+func deadline(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(timeout)
+}
+
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+
+	return host
+}
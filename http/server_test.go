@@ -0,0 +1,1026 @@
+package http_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	nethttp "net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+var dateHeaderRegex = regexp.MustCompile("(?m)^Date: [^\r]*\r\n")
+
+func newServer(t *testing.T, address string, mux *http.Mux) *http.Server {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server, err := http.NewServer(address, mux, logger)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	return server
+}
+
+// startServer starts server and stops it when the test ends. The returned
+// channel receives the error returned by Start.
+func startServer(t *testing.T, server *http.Server) chan error {
+	t.Helper()
+
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- server.Start()
+	}()
+
+	select {
+	case <-server.Created:
+	case err := <-startErr:
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	t.Cleanup(func() {
+		server.Stop()
+	})
+
+	return startErr
+}
+
+// readHead reads the status line and headers of a response, leaving out the
+// Date header since it changes every second.
+func readHead(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	var head strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read response head: %v", err)
+		}
+
+		if !strings.HasPrefix(line, "Date: ") {
+			head.WriteString(line)
+		}
+		if line == "\r\n" {
+			return head.String()
+		}
+	}
+}
+
+// withoutDate removes the Date header from a raw response.
+func withoutDate(response string) string {
+	return dateHeaderRegex.ReplaceAllString(response, "")
+}
+
+func sendRawRequest(t *testing.T, conn net.Conn, path string) {
+	t.Helper()
+
+	_, err := fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\n\r\n", path)
+	if err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("waits for in-flight requests and closes idle connections", func(t *testing.T) {
+		started := make(chan bool)
+		release := make(chan bool)
+
+		mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		mux.HandleFunc("GET /fast", func(req *http.Request, resp *http.Response) {})
+		mux.HandleFunc("GET /slow", func(req *http.Request, resp *http.Response) {
+			started <- true
+			<-release
+			resp.Body = []byte("done")
+		})
+
+		address := "localhost:8282"
+		server := newServer(t, address, mux)
+		startErr := startServer(t, server)
+
+		// connection that becomes idle after its first request
+		idleConn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer idleConn.Close()
+		idleReader := bufio.NewReader(idleConn)
+		sendRawRequest(t, idleConn, "/fast")
+		idleResp, err := nethttp.ReadResponse(idleReader, nil)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		idleResp.Body.Close()
+
+		activeConn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer activeConn.Close()
+		sendRawRequest(t, activeConn, "/slow")
+		<-started
+
+		shutdownErr := make(chan error, 1)
+		go func() {
+			shutdownErr <- server.Shutdown(context.Background())
+		}()
+
+		// idle connection is closed by the server
+		idleConn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = idleReader.ReadByte()
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("expected idle connection to be closed, got %v", err)
+		}
+
+		select {
+		case err := <-shutdownErr:
+			t.Fatalf("expected Shutdown to wait for in-flight request, returned %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(release)
+
+		resp, err := nethttp.ReadResponse(bufio.NewReader(activeConn), nil)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "done" {
+			t.Errorf("expected body \"done\", got %q", body)
+		}
+		if !resp.Close {
+			t.Errorf("expected response to have Connection: close")
+		}
+
+		err = <-shutdownErr
+		if err != nil {
+			t.Errorf("expected no error from Shutdown, got %v", err)
+		}
+
+		err = <-startErr
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("expected Start to return ErrServerClosed, got %v", err)
+		}
+	})
+
+	t.Run("closes active connections when context expires", func(t *testing.T) {
+		started := make(chan bool)
+		release := make(chan bool)
+		defer close(release)
+
+		mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		mux.HandleFunc("GET /slow", func(req *http.Request, resp *http.Response) {
+			started <- true
+			<-release
+		})
+
+		address := "localhost:8283"
+		server := newServer(t, address, mux)
+		startServer(t, server)
+
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+		sendRawRequest(t, conn, "/slow")
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err = server.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context.DeadlineExceeded, got %v", err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("expected connection to be closed, got %v", err)
+		}
+	})
+
+	t.Run("Start after Shutdown returns", func(t *testing.T) {
+		mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		server := newServer(t, "localhost:8283", mux)
+
+		err := server.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error from Shutdown, got %v", err)
+		}
+
+		startErr := make(chan error, 1)
+		go func() {
+			startErr <- server.Start()
+		}()
+
+		select {
+		case err := <-startErr:
+			if !errors.Is(err, http.ErrServerClosed) {
+				t.Errorf("expected Start to return ErrServerClosed, got %v", err)
+			}
+		case <-time.After(time.Second):
+			server.Stop()
+			t.Fatalf("expected Start to return after Shutdown")
+		}
+	})
+}
+
+func TestTimeouts(t *testing.T) {
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /", func(req *http.Request, resp *http.Response) {})
+
+	address := "localhost:8284"
+	server := newServer(t, address, mux)
+	server.ReadHeaderTimeout = 100 * time.Millisecond
+	server.ReadBodyTimeout = 100 * time.Millisecond
+	server.IdleTimeout = 500 * time.Millisecond
+	startServer(t, server)
+
+	t.Run("responds 408 when headers are not sent in time", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n")
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		resp, err := nethttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+
+		if resp.StatusCode != 408 {
+			t.Errorf("expected status code 408, got %d", resp.StatusCode)
+		}
+		if !resp.Close {
+			t.Errorf("expected response to have Connection: close")
+		}
+	})
+
+	t.Run("responds 408 when body is not sent in time", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nfoo")
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		resp, err := nethttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+
+		if resp.StatusCode != 408 {
+			t.Errorf("expected status code 408, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("closes silent new connection after ReadHeaderTimeout", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		start := time.Now()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(make([]byte, 1))
+		if n != 0 || !errors.Is(err, io.EOF) {
+			t.Errorf("expected connection to be closed without response, got %d bytes and %v", n, err)
+		}
+
+		if elapsed := time.Since(start); elapsed >= server.IdleTimeout {
+			t.Errorf("expected connection to be closed within ReadHeaderTimeout, took %v", elapsed)
+		}
+	})
+
+	t.Run("closes keep-alive connection after IdleTimeout", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		reader := bufio.NewReader(conn)
+		resp, err := nethttp.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		resp.Body.Close()
+
+		start := time.Now()
+		n, err := reader.Read(make([]byte, 1))
+		if n != 0 || !errors.Is(err, io.EOF) {
+			t.Errorf("expected connection to be closed without response, got %d bytes and %v", n, err)
+		}
+
+		if elapsed := time.Since(start); elapsed < server.IdleTimeout/2 {
+			t.Errorf("expected connection to be kept for IdleTimeout, closed after %v", elapsed)
+		}
+	})
+}
+
+func TestConnectionLimits(t *testing.T) {
+	// dial connects to address and makes sure that the server has accepted
+	// the connection by completing a request on it.
+	dial := func(t *testing.T, address string) (net.Conn, *nethttp.Response) {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		t.Cleanup(func() {
+			conn.Close()
+		})
+
+		sendRawRequest(t, conn, "/")
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		resp, err := nethttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return conn, nil
+		}
+		resp.Body.Close()
+
+		return conn, resp
+	}
+
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /", func(req *http.Request, resp *http.Response) {})
+
+	t.Run("rejects connections over MaxConns with 503", func(t *testing.T) {
+		address := "localhost:8285"
+		server := newServer(t, address, mux)
+		server.MaxConns = 1
+		server.RejectOverLimit = true
+		server.RetryAfter = 5 * time.Second
+		startServer(t, server)
+
+		_, resp := dial(t, address)
+		if resp == nil || resp.StatusCode != 200 {
+			t.Fatalf("expected first connection to be served, got %v", resp)
+		}
+
+		_, resp = dial(t, address)
+		if resp == nil || resp.StatusCode != 503 {
+			t.Fatalf("expected second connection to be rejected with 503, got %v", resp)
+		}
+
+		if resp.Header.Get("Retry-After") != "5" {
+			t.Errorf("expected Retry-After header to be 5, got %q", resp.Header.Get("Retry-After"))
+		}
+	})
+
+	t.Run("stops accepting connections over MaxConns", func(t *testing.T) {
+		address := "localhost:8286"
+		server := newServer(t, address, mux)
+		server.MaxConns = 1
+		startServer(t, server)
+
+		first, resp := dial(t, address)
+		if resp == nil || resp.StatusCode != 200 {
+			t.Fatalf("expected first connection to be served, got %v", resp)
+		}
+
+		second, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer second.Close()
+		sendRawRequest(t, second, "/")
+		secondReader := bufio.NewReader(second)
+
+		second.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err = secondReader.ReadByte()
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected second connection to wait, got %v", err)
+		}
+		secondReader.UnreadByte()
+
+		first.Close()
+
+		second.SetReadDeadline(time.Now().Add(time.Second))
+		resp, err = nethttp.ReadResponse(secondReader, nil)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Errorf("expected status code 200, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("rejects connections over MaxConnsPerIP with 503", func(t *testing.T) {
+		address := "localhost:8287"
+		server := newServer(t, address, mux)
+		server.MaxConnsPerIP = 1
+		startServer(t, server)
+
+		first, resp := dial(t, address)
+		if resp == nil || resp.StatusCode != 200 {
+			t.Fatalf("expected first connection to be served, got %v", resp)
+		}
+
+		_, resp = dial(t, address)
+		if resp == nil || resp.StatusCode != 503 {
+			t.Fatalf("expected second connection to be rejected with 503, got %v", resp)
+		}
+
+		first.Close()
+
+		// the server notices the closed connection asynchronously
+		for i := 0; i < 20; i++ {
+			_, resp = dial(t, address)
+			if resp != nil && resp.StatusCode == 200 {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if resp == nil || resp.StatusCode != 200 {
+			t.Fatalf("expected connection to be served after the first one is closed, got %v", resp)
+		}
+	})
+}
+
+func TestHeadResponse(t *testing.T) {
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /fixed", func(req *http.Request, resp *http.Response) {
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Body = []byte("hello")
+	})
+	mux.HandleFunc("GET /stream", func(req *http.Request, resp *http.Response) {
+		resp.Write([]byte("hello"))
+		resp.Flush()
+		resp.Write([]byte(" world"))
+	})
+
+	address := "localhost:8289"
+	startServer(t, newServer(t, address, mux))
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+
+	// every response is read from the same connection, so any body bytes
+	// sent for HEAD would corrupt the responses that follow
+	for _, tc := range []struct {
+		method       string
+		path         string
+		expectedHead string
+		expectedBody string
+	}{
+		{method: "HEAD", path: "/fixed", expectedHead: "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\n"},
+		{method: "HEAD", path: "/stream",
+			expectedHead: "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nTransfer-Encoding: chunked\r\n\r\n"},
+		{method: "GET", path: "/fixed", expectedHead: "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\n",
+			expectedBody: "hello"},
+	} {
+		fmt.Fprintf(conn, "%s %s HTTP/1.1\r\nHost: localhost\r\n\r\n", tc.method, tc.path)
+
+		head := readHead(t, reader)
+		if head != tc.expectedHead {
+			t.Errorf("expected %q for %v %v, got %q", tc.expectedHead, tc.method, tc.path, head)
+		}
+
+		body := make([]byte, len(tc.expectedBody))
+		_, err := io.ReadFull(reader, body)
+		if err != nil {
+			t.Fatalf("failed to read response to %v %v: %v", tc.method, tc.path, err)
+		}
+
+		if string(body) != tc.expectedBody {
+			t.Errorf("expected body %q for %v %v, got %q", tc.expectedBody, tc.method, tc.path, body)
+		}
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /panic", func(req *http.Request, resp *http.Response) {
+		resp.Headers.Set("X-Partial", "yes")
+		panic("boom")
+	})
+	mux.HandleFunc("GET /panic-after-flush", func(req *http.Request, resp *http.Response) {
+		resp.Write([]byte("partial"))
+		resp.Flush()
+		panic("boom")
+	})
+	bodyClosed := make(chan bool, 1)
+	mux.HandleFunc("GET /panic-with-body-reader", func(req *http.Request, resp *http.Response) {
+		resp.BodyReader = closeNotifier{Reader: strings.NewReader("body"), closed: bodyClosed}
+		resp.Flush()
+		panic("boom")
+	})
+	mux.HandleFunc("GET /ok", func(req *http.Request, resp *http.Response) {
+		resp.Body = []byte("ok")
+	})
+	mux.HandleFunc("GET /invalid-status", func(req *http.Request, resp *http.Response) {
+		resp.StatusCode = 1000
+		resp.Body = []byte("invalid")
+	})
+
+	address := "localhost:8290"
+	startServer(t, newServer(t, address, mux))
+
+	t.Run("responds 500 and keeps the connection", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		reader := bufio.NewReader(conn)
+
+		sendRawRequest(t, conn, "/panic")
+		expected := "HTTP/1.1 500 Internal Server Error\r\nContent-Type: text/plain\r\nContent-Length: 21\r\n\r\nInternal Server Error"
+		got := make([]byte, len("Internal Server Error"))
+		head := readHead(t, reader)
+		_, err = io.ReadFull(reader, got)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if head+string(got) != expected {
+			t.Errorf("expected %q, got %q", expected, head+string(got))
+		}
+
+		// the server survives and the connection can be reused
+		sendRawRequest(t, conn, "/ok")
+		resp, err := nethttp.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Errorf("expected status code 200, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("closes the connection after headers were sent", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		sendRawRequest(t, conn, "/panic-after-flush")
+		got, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("expected connection to be closed, got %v", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nTransfer-Encoding: chunked\r\n\r\n7\r\npartial\r\n"
+		if withoutDate(string(got)) != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("closes the body reader after headers were sent", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		sendRawRequest(t, conn, "/panic-with-body-reader")
+		io.ReadAll(conn)
+
+		select {
+		case <-bodyClosed:
+		case <-time.After(time.Second):
+			t.Errorf("expected body reader to be closed")
+		}
+	})
+
+	t.Run("responds 500 to an invalid status code", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		sendRawRequest(t, conn, "/invalid-status")
+		resp, err := nethttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("expected status code 500, got %d", resp.StatusCode)
+		}
+	})
+}
+
+// closeNotifier tells when a body reader is closed by the server.
+type closeNotifier struct {
+	io.Reader
+	closed chan bool
+}
+
+func (c closeNotifier) Close() error {
+	c.closed <- true
+	return nil
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /", func(req *http.Request, resp *http.Response) {
+		resp.Body = []byte("<html><body>hello</body></html>")
+	})
+	mux.HandleFunc("GET /no-date", func(req *http.Request, resp *http.Response) {
+		resp.Headers.Del("Date")
+		resp.Headers.Set("Server", "custom")
+	})
+
+	address := "localhost:8291"
+	server := newServer(t, address, mux)
+	server.ServerHeader = "test-server"
+	startServer(t, server)
+
+	t.Run("adds Date, Server and sniffed Content-Type", func(t *testing.T) {
+		resp, err := nethttp.Get("http://" + address + "/")
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		date, err := nethttp.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			t.Fatalf("expected valid Date header, got %q: %v", resp.Header.Get("Date"), err)
+		}
+		if time.Since(date) > 2*time.Second {
+			t.Errorf("expected current date, got %v", date)
+		}
+
+		if resp.Header.Get("Server") != "test-server" {
+			t.Errorf("expected Server header \"test-server\", got %q", resp.Header.Get("Server"))
+		}
+
+		if resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("expected sniffed Content-Type, got %q", resp.Header.Get("Content-Type"))
+		}
+	})
+
+	t.Run("handlers can change the default headers", func(t *testing.T) {
+		resp, err := nethttp.Get("http://" + address + "/no-date")
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.Header.Get("Date") != "" {
+			t.Errorf("expected no Date header, got %q", resp.Header.Get("Date"))
+		}
+
+		if resp.Header.Get("Server") != "custom" {
+			t.Errorf("expected Server header \"custom\", got %q", resp.Header.Get("Server"))
+		}
+
+		if resp.Header.Get("Content-Type") != "" {
+			t.Errorf("expected no Content-Type for empty body, got %q", resp.Header.Get("Content-Type"))
+		}
+	})
+}
+
+func TestServeFile(t *testing.T) {
+	// larger than what is sent to the connection at once
+	content := strings.Repeat("0123456789abcdef", 200*1024)
+	path := t.TempDir() + "/file"
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /file", func(req *http.Request, resp *http.Response) {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Errorf("failed to open file: %v", err)
+			resp.StatusCode = http.StatusInternalServerError
+			return
+		}
+
+		info, _ := file.Stat()
+		err = http.ServeContent(req, resp, file, info.Size(), info.ModTime())
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+	mux.HandleFunc("GET /compressed", func(req *http.Request, resp *http.Response) {
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Headers.Set("Content-Length", strconv.Itoa(len(content)))
+		resp.BodyReader = strings.NewReader(content)
+	}, http.Compress(http.DefaultCompressMinSize))
+
+	address := "localhost:8292"
+	server := newServer(t, address, mux)
+	server.WriteTimeout = time.Second
+	startServer(t, server)
+
+	var testCases = []struct {
+		description        string
+		path               string
+		headers            map[string]string
+		expectedStatus     int
+		expectedBody       string
+		expectedCompressed bool
+	}{
+		{
+			description:    "whole file",
+			path:           "/file",
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+		{
+			description:    "range of the file",
+			path:           "/file",
+			headers:        map[string]string{"Range": "bytes=1000-2000999"},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   content[1000:2001000],
+		},
+		{
+			// the client asks for gzip and decodes the body itself
+			description:        "compressed body",
+			path:               "/compressed",
+			expectedStatus:     http.StatusOK,
+			expectedBody:       content,
+			expectedCompressed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req, _ := nethttp.NewRequest("GET", "http://"+address+tc.path, nil)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+
+			resp, err := nethttp.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("failed to send request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+
+			if string(body) != tc.expectedBody {
+				t.Errorf("expected body of %d bytes, got %d bytes", len(tc.expectedBody), len(body))
+			}
+
+			if resp.Uncompressed != tc.expectedCompressed {
+				t.Errorf("expected compressed body %v, got %v", tc.expectedCompressed, resp.Uncompressed)
+			}
+		})
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("POST /", func(req *http.Request, resp *http.Response) {
+		resp.Body = req.Body
+	})
+
+	address := "localhost:8293"
+	server := newServer(t, address, mux)
+	server.MaxBodySize = 8
+	startServer(t, server)
+
+	var testCases = []struct {
+		description    string
+		rawRequest     string
+		expectedStatus int
+	}{
+		{
+			description:    "body within the limit",
+			rawRequest:     "POST / HTTP/1.1\r\nContent-Length: 8\r\nConnection: close\r\n\r\n12345678",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "body over the limit",
+			rawRequest:     "POST / HTTP/1.1\r\nContent-Length: 40000000000000\r\n\r\n123456789",
+			expectedStatus: http.StatusContentTooLarge,
+		},
+		{
+			description:    "chunked body over the limit",
+			rawRequest:     "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n12345\r\n5\r\n67890\r\n0\r\n\r\n",
+			expectedStatus: http.StatusContentTooLarge,
+		},
+		{
+			description:    "huge chunk",
+			rawRequest:     "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nfffffffff\r\n123",
+			expectedStatus: http.StatusContentTooLarge,
+		},
+		{
+			description:    "too many headers",
+			rawRequest:     "POST / HTTP/1.1\r\n" + strings.Repeat("X-Foo: bar\r\n", 101) + "\r\n",
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		{
+			description:    "header longer than the read buffer",
+			rawRequest:     "POST / HTTP/1.1\r\nCookie: " + strings.Repeat("a", 5000) + "\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "header line over the limit",
+			rawRequest:     "POST / HTTP/1.1\r\nCookie: " + strings.Repeat("a", 70*1024) + "\r\n\r\n",
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		{
+			description:    "request line over the limit",
+			rawRequest:     "POST /" + strings.Repeat("a", 70*1024) + " HTTP/1.1\r\n\r\n",
+			expectedStatus: http.StatusURITooLong,
+		},
+		{
+			description:    "malformed header line",
+			rawRequest:     "POST / HTTP/1.1\r\nnot a header\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "invalid Content-Length",
+			rawRequest:     "POST / HTTP/1.1\r\nContent-Length: ten\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "unsupported Transfer-Encoding",
+			rawRequest:     "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			conn, err := net.Dial("tcp", address)
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+
+			_, err = io.WriteString(conn, tc.rawRequest)
+			if err != nil {
+				t.Fatalf("failed to write request: %v", err)
+			}
+
+			resp, err := nethttp.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if tc.expectedStatus != http.StatusOK && !resp.Close {
+				t.Errorf("expected the connection to be closed after status code %d", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHTTP10StreamingResponse(t *testing.T) {
+	text := strings.Repeat("streamed text ", 200)
+
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /", func(req *http.Request, resp *http.Response) {
+		resp.Headers.Set("Content-Type", "text/plain")
+		resp.Write([]byte(text))
+		resp.Flush()
+		resp.Write([]byte(text))
+	}, http.Compress(http.DefaultCompressMinSize))
+
+	address := "localhost:8294"
+	server := newServer(t, address, mux)
+	startServer(t, server)
+
+	for _, acceptEncoding := range []string{"identity", "gzip"} {
+		t.Run(acceptEncoding, func(t *testing.T) {
+			conn, err := net.Dial("tcp", address)
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+
+			fmt.Fprintf(conn, "GET / HTTP/1.0\r\nAccept-Encoding: %s\r\n\r\n", acceptEncoding)
+
+			// the body ends when the server closes the connection
+			raw, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+
+			resp, err := nethttp.ReadResponse(bufio.NewReader(strings.NewReader(string(raw))), &nethttp.Request{Method: "GET", ProtoMajor: 1})
+			if err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+
+			if len(resp.TransferEncoding) != 0 {
+				t.Errorf("expected no Transfer-Encoding, got %v", resp.TransferEncoding)
+			}
+
+			if !resp.Close {
+				t.Errorf("expected Connection: close")
+			}
+
+			var body io.Reader = resp.Body
+			if resp.Header.Get("Content-Encoding") == "gzip" {
+				body, err = gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("failed to create decoder: %v", err)
+				}
+			} else if acceptEncoding == "gzip" {
+				t.Errorf("expected gzip Content-Encoding, got %q", resp.Header.Get("Content-Encoding"))
+			}
+
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+
+			if string(decoded) != text+text {
+				t.Errorf("expected body of %d bytes, got %q", len(text+text), decoded)
+			}
+		})
+	}
+}
+
+func TestContentLengthMismatch(t *testing.T) {
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /long", func(req *http.Request, resp *http.Response) {
+		resp.Headers.Set("Content-Length", "3")
+		resp.Write([]byte("hello world"))
+	})
+	mux.HandleFunc("GET /short", func(req *http.Request, resp *http.Response) {
+		resp.Headers.Set("Content-Length", "20")
+		resp.Write([]byte("hello world"))
+	})
+
+	address := "localhost:8295"
+	server := newServer(t, address, mux)
+	startServer(t, server)
+
+	var testCases = []struct {
+		path         string
+		expectedBody string
+	}{
+		{path: "/long", expectedBody: "hel"},
+		{path: "/short", expectedBody: "hello world"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			conn, err := net.Dial("tcp", address)
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+
+			// a second request on the same connection must not get the
+			// rest of the first body as its response
+			fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\n\r\nGET %s HTTP/1.1\r\nHost: localhost\r\n\r\n", tc.path, tc.path)
+
+			raw, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+
+			_, body, found := strings.Cut(string(raw), "\r\n\r\n")
+			if !found || body != tc.expectedBody {
+				t.Errorf("expected a single response with body %q, got %q", tc.expectedBody, raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package http
+
+import (
+	"bytes"
+)
+
+const (
+	// DetectContentType looks at no more than this many bytes
+	sniffLen = 512
+)
+
+// sniffSig is a signature of a content type. match returns the content type
+// if data starts with the signature, or an empty string.
+type sniffSig interface {
+	match(data []byte) string
+}
+
+var (
+	// Signatures in the order they are tried, following the "identifying a
+	// resource with an unknown MIME type" rules of the WHATWG MIME Sniffing
+	// standard.
+	sniffSigs = []sniffSig{
+		htmlSig("<!DOCTYPE HTML"),
+		htmlSig("<HTML"),
+		htmlSig("<HEAD"),
+		htmlSig("<SCRIPT"),
+		htmlSig("<IFRAME"),
+		htmlSig("<H1"),
+		htmlSig("<DIV"),
+		htmlSig("<FONT"),
+		htmlSig("<TABLE"),
+		htmlSig("<A"),
+		htmlSig("<STYLE"),
+		htmlSig("<TITLE"),
+		htmlSig("<B"),
+		htmlSig("<BODY"),
+		htmlSig("<BR"),
+		htmlSig("<P"),
+		htmlSig("<!--"),
+		&maskedSig{
+			mask:    []byte("\xFF\xFF\xFF\xFF\xFF"),
+			pattern: []byte("<?xml"),
+			skipWS:  true,
+			ct:      "text/xml; charset=utf-8",
+		},
+		&exactSig{[]byte("%PDF-"), "application/pdf"},
+		&exactSig{[]byte("%!PS-Adobe-"), "application/postscript"},
+
+		// byte order marks
+		&exactSig{[]byte("\xFE\xFF"), "text/plain; charset=utf-16be"},
+		&exactSig{[]byte("\xFF\xFE"), "text/plain; charset=utf-16le"},
+		&exactSig{[]byte("\xEF\xBB\xBF"), "text/plain; charset=utf-8"},
+
+		// images
+		&exactSig{[]byte("\x00\x00\x01\x00"), "image/x-icon"},
+		&exactSig{[]byte("\x00\x00\x02\x00"), "image/x-icon"},
+		&exactSig{[]byte("BM"), "image/bmp"},
+		&exactSig{[]byte("GIF87a"), "image/gif"},
+		&exactSig{[]byte("GIF89a"), "image/gif"},
+		&maskedSig{
+			mask:    []byte("\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF\xFF\xFF"),
+			pattern: []byte("RIFF\x00\x00\x00\x00WEBPVP"),
+			ct:      "image/webp",
+		},
+		&exactSig{[]byte("\x89PNG\x0D\x0A\x1A\x0A"), "image/png"},
+		&exactSig{[]byte("\xFF\xD8\xFF"), "image/jpeg"},
+
+		// audio and video
+		&maskedSig{
+			mask:    []byte("\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF"),
+			pattern: []byte("FORM\x00\x00\x00\x00AIFF"),
+			ct:      "audio/aiff",
+		},
+		&exactSig{[]byte("ID3"), "audio/mpeg"},
+		&exactSig{[]byte("OggS\x00"), "application/ogg"},
+		&exactSig{[]byte("MThd\x00\x00\x00\x06"), "audio/midi"},
+		&maskedSig{
+			mask:    []byte("\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF"),
+			pattern: []byte("RIFF\x00\x00\x00\x00AVI "),
+			ct:      "video/avi",
+		},
+		&maskedSig{
+			mask:    []byte("\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF"),
+			pattern: []byte("RIFF\x00\x00\x00\x00WAVE"),
+			ct:      "audio/wave",
+		},
+		mp4Sig{},
+		&exactSig{[]byte("\x1A\x45\xDF\xA3"), "video/webm"},
+
+		// fonts
+		&exactSig{[]byte("\x00\x01\x00\x00"), "font/ttf"},
+		&exactSig{[]byte("OTTO"), "font/otf"},
+		&exactSig{[]byte("wOFF"), "font/woff"},
+		&exactSig{[]byte("wOF2"), "font/woff2"},
+
+		// archives
+		&exactSig{[]byte("\x1F\x8B\x08"), "application/x-gzip"},
+		&exactSig{[]byte("PK\x03\x04"), "application/zip"},
+		&exactSig{[]byte("Rar!\x1A\x07\x00"), "application/x-rar-compressed"},
+		&exactSig{[]byte("Rar!\x1A\x07\x01\x00"), "application/x-rar-compressed"},
+
+		&exactSig{[]byte("\x00\x61\x73\x6D"), "application/wasm"},
+
+		textSig{},
+	}
+)
+
+// DetectContentType returns the content type of data, judging by at most its
+// first 512 bytes. It returns "application/octet-stream" if the data doesn't
+// match any known signature and looks binary.
+func DetectContentType(data []byte) string {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+
+	for _, sig := range sniffSigs {
+		ct := sig.match(data)
+		if ct != "" {
+			return ct
+		}
+	}
+
+	return "application/octet-stream"
+}
+
+type exactSig struct {
+	sig []byte
+	ct  string
+}
+
+func (s *exactSig) match(data []byte) string {
+	if bytes.HasPrefix(data, s.sig) {
+		return s.ct
+	}
+
+	return ""
+}
+
+// maskedSig matches when the data ANDed with mask starts with pattern,
+// optionally after leading whitespace.
+type maskedSig struct {
+	mask    []byte
+	pattern []byte
+	skipWS  bool
+	ct      string
+}
+
+func (s *maskedSig) match(data []byte) string {
+	if s.skipWS {
+		data = data[firstNonWS(data):]
+	}
+
+	if len(data) < len(s.pattern) {
+		return ""
+	}
+
+	for i, b := range s.pattern {
+		if data[i]&s.mask[i] != b {
+			return ""
+		}
+	}
+
+	return s.ct
+}
+
+// htmlSig matches an HTML tag, case-insensitively and after leading
+// whitespace, followed by a space or ">".
+type htmlSig string
+
+func (s htmlSig) match(data []byte) string {
+	data = data[firstNonWS(data):]
+	if len(data) < len(s)+1 {
+		return ""
+	}
+
+	if !bytes.EqualFold(data[:len(s)], []byte(s)) {
+		return ""
+	}
+
+	switch data[len(s)] {
+	case ' ', '>':
+		return "text/html; charset=utf-8"
+	}
+
+	return ""
+}
+
+// mp4Sig matches an ISO base media file starting with an "ftyp" box of an
+// MP4 brand.
+type mp4Sig struct{}
+
+func (mp4Sig) match(data []byte) string {
+	if len(data) < 12 {
+		return ""
+	}
+
+	boxSize := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if boxSize%4 != 0 || len(data) < boxSize || string(data[4:8]) != "ftyp" {
+		return ""
+	}
+
+	for i := 8; i+3 <= boxSize; i += 4 {
+		// bytes 12 to 15 are the minor version, not a brand
+		if i == 12 {
+			continue
+		}
+
+		if string(data[i:i+3]) == "mp4" {
+			return "video/mp4"
+		}
+	}
+
+	return ""
+}
+
+// textSig matches data without binary bytes, which is assumed to be UTF-8.
+type textSig struct{}
+
+func (textSig) match(data []byte) string {
+	for _, b := range data {
+		switch {
+		case b <= 0x08,
+			b == 0x0B,
+			0x0E <= b && b <= 0x1A,
+			0x1C <= b && b <= 0x1F:
+			return ""
+		}
+	}
+
+	return "text/plain; charset=utf-8"
+}
+
+// firstNonWS returns the index of the first byte of data that isn't
+// whitespace as defined by the sniffing standard.
+func firstNonWS(data []byte) int {
+	i := 0
+	for i < len(data) {
+		switch data[i] {
+		case '\t', '\n', '\x0C', '\r', ' ':
+			i++
+			continue
+		}
+		break
+	}
+
+	return i
+}
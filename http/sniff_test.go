@@ -0,0 +1,47 @@
+package http_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+func TestDetectContentType(t *testing.T) {
+	var testCases = []struct {
+		description string
+		data        []byte
+		expected    string
+	}{
+		{description: "plain text", data: []byte("Hello, World!"), expected: "text/plain; charset=utf-8"},
+		{description: "HTML document", data: []byte("<!DOCTYPE html><html></html>"), expected: "text/html; charset=utf-8"},
+		{description: "HTML after whitespace", data: []byte("\n  <HTML>"), expected: "text/html; charset=utf-8"},
+		{description: "tag prefix is not HTML", data: []byte("<htmlx>"), expected: "text/plain; charset=utf-8"},
+		{description: "HTML comment", data: []byte("<!-- x -->"), expected: "text/html; charset=utf-8"},
+		{description: "XML", data: []byte(" <?xml version=\"1.0\"?>"), expected: "text/xml; charset=utf-8"},
+		{description: "PDF", data: []byte("%PDF-1.7"), expected: "application/pdf"},
+		{description: "UTF-16 BOM", data: []byte("\xFF\xFEh\x00"), expected: "text/plain; charset=utf-16le"},
+		{description: "PNG", data: []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR"), expected: "image/png"},
+		{description: "JPEG", data: []byte("\xFF\xD8\xFF\xE0"), expected: "image/jpeg"},
+		{description: "GIF", data: []byte("GIF89a"), expected: "image/gif"},
+		{description: "WebP", data: []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), expected: "image/webp"},
+		{description: "WAVE", data: []byte("RIFF\x24\x00\x00\x00WAVEfmt "), expected: "audio/wave"},
+		{description: "MP4", data: []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), expected: "video/mp4"},
+		{description: "gzip", data: []byte("\x1F\x8B\x08\x00"), expected: "application/x-gzip"},
+		{description: "zip", data: []byte("PK\x03\x04"), expected: "application/zip"},
+		{description: "WOFF2", data: []byte("wOF2"), expected: "font/woff2"},
+		{description: "wasm", data: []byte("\x00asm\x01\x00\x00\x00"), expected: "application/wasm"},
+		{description: "binary", data: []byte("\x00\x01\x02\x03"), expected: "application/octet-stream"},
+		// only the first 512 bytes are looked at
+		{description: "binary after 512 bytes", data: []byte(strings.Repeat("a", 512) + "\x00"), expected: "text/plain; charset=utf-8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			got := http.DetectContentType(tc.data)
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
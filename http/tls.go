@@ -0,0 +1,175 @@
+package http
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// how often certificate files are checked for changes
+	certReloadInterval = 5 * time.Second
+)
+
+// CertificateFiles are the paths of a PEM encoded certificate chain and of
+// its private key.
+type CertificateFiles struct {
+	CertFile string
+	KeyFile  string
+}
+
+// certStore hands out certificates during TLS handshakes. The certificate is
+// selected by the server name the client asked for (SNI), and certificate
+// files are reloaded when they change on disk, so that renewed certificates
+// are picked up without restarting the server.
+type certStore struct {
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	certs []*storedCert
+
+	// lastCheck is when certificate files were last checked for changes, in
+	// Unix nanoseconds
+	lastCheck atomic.Int64
+}
+
+type storedCert struct {
+	files       CertificateFiles
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func newCertStore(files []CertificateFiles, logger *slog.Logger) (*certStore, error) {
+	store := &certStore{
+		logger: logger,
+	}
+	store.lastCheck.Store(time.Now().UnixNano())
+
+	for _, f := range files {
+		stored, loadErr := loadCert(f)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		store.certs = append(store.certs, stored)
+	}
+
+	return store, nil
+}
+
+// tlsConfig returns the TLS configuration for a listener serving the
+// certificates of the store.
+func (cs *certStore) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"http/1.1"},
+		GetCertificate: cs.getCertificate,
+	}
+}
+
+func (cs *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.reloadIfChanged()
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if len(cs.certs) == 0 {
+		return nil, fmt.Errorf("no certificates configured")
+	}
+
+	if hello.ServerName != "" {
+		for _, stored := range cs.certs {
+			if stored.cert.Leaf != nil && stored.cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return stored.cert, nil
+			}
+		}
+	}
+
+	// The first certificate is the default one for clients that don't send
+	// SNI or ask for an unknown name.
+	return cs.certs[0].cert, nil
+}
+
+// reloadIfChanged reloads certificates whose files were modified, checking
+// at most once per certReloadInterval. A certificate that fails to load, for
+// example because it is only partially written, is kept as it was and tried
+// again on the next check.
+//
+// Only the handshake that is due to check does it, and files are read
+// without holding the lock, so other handshakes are never held up.
+func (cs *certStore) reloadIfChanged() {
+	lastCheck := cs.lastCheck.Load()
+	now := time.Now()
+	if now.Sub(time.Unix(0, lastCheck)) < certReloadInterval {
+		return
+	}
+
+	if !cs.lastCheck.CompareAndSwap(lastCheck, now.UnixNano()) {
+		return // another handshake is checking
+	}
+
+	cs.mu.RLock()
+	certs := slices.Clone(cs.certs)
+	cs.mu.RUnlock()
+
+	for i, stored := range certs {
+		certModTime, keyModTime, statErr := modTimes(stored.files)
+		if statErr != nil {
+			cs.logger.Error("cannot check certificate files", "error", statErr)
+			continue
+		}
+
+		if certModTime.Equal(stored.certModTime) && keyModTime.Equal(stored.keyModTime) {
+			continue
+		}
+
+		reloaded, loadErr := loadCert(stored.files)
+		if loadErr != nil {
+			cs.logger.Error("cannot reload certificate", "error", loadErr)
+			continue
+		}
+
+		cs.mu.Lock()
+		cs.certs[i] = reloaded
+		cs.mu.Unlock()
+		cs.logger.Info("certificate reloaded", "cert_file", stored.files.CertFile)
+	}
+}
+
+func loadCert(files CertificateFiles) (*storedCert, error) {
+	certModTime, keyModTime, statErr := modTimes(files)
+	if statErr != nil {
+		return nil, statErr
+	}
+
+	cert, loadErr := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	if loadErr != nil {
+		return nil, fmt.Errorf("cannot load certificate %v: %w", files.CertFile, loadErr)
+	}
+
+	return &storedCert{
+		files:       files,
+		cert:        &cert,
+		certModTime: certModTime,
+		keyModTime:  keyModTime,
+	}, nil
+}
+
+func modTimes(files CertificateFiles) (time.Time, time.Time, error) {
+	certInfo, certErr := os.Stat(files.CertFile)
+	if certErr != nil {
+		return time.Time{}, time.Time{}, certErr
+	}
+
+	keyInfo, keyErr := os.Stat(files.KeyFile)
+	if keyErr != nil {
+		return time.Time{}, time.Time{}, keyErr
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
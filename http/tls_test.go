@@ -0,0 +1,162 @@
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/http"
+)
+
+// writeCertificate writes a self-signed certificate for hostname with the
+// given serial number into dir and returns the paths of the files.
+func writeCertificate(t *testing.T, dir string, hostname string, serial int64) http.CertificateFiles {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	files := http.CertificateFiles{
+		CertFile: filepath.Join(dir, hostname+".crt"),
+		KeyFile:  filepath.Join(dir, hostname+".key"),
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	// write the key first so that a reload never sees a new certificate
+	// with the old key
+	err = os.WriteFile(files.KeyFile, keyPEM, 0600)
+	if err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	err = os.WriteFile(files.CertFile, certPEM, 0600)
+	if err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+
+	return files
+}
+
+func TestTLS(t *testing.T) {
+	defer http.SetCertReloadInterval(10 * time.Millisecond)()
+
+	dir := t.TempDir()
+	fooCert := writeCertificate(t, dir, "foo.test", 1)
+	barCert := writeCertificate(t, dir, "bar.test", 2)
+
+	mux := http.NewMux(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mux.HandleFunc("GET /", func(req *http.Request, resp *http.Response) {
+		resp.Body = []byte("secure")
+	})
+
+	address := "localhost:8288"
+	server := newServer(t, address, mux)
+	server.Certificates = []http.CertificateFiles{fooCert, barCert}
+	startServer(t, server)
+
+	// handshake connects with the given server name and returns the serial
+	// number of the certificate presented by the server.
+	handshake := func(t *testing.T, serverName string) int64 {
+		t.Helper()
+
+		conn, err := tls.Dial("tcp", address, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2", "http/1.1"},
+		})
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		state := conn.ConnectionState()
+		if state.NegotiatedProtocol != "http/1.1" {
+			t.Errorf("expected http/1.1 to be negotiated, got %q", state.NegotiatedProtocol)
+		}
+
+		return state.PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	t.Run("selects certificate by server name", func(t *testing.T) {
+		if serial := handshake(t, "foo.test"); serial != 1 {
+			t.Errorf("expected certificate 1 for foo.test, got %d", serial)
+		}
+
+		if serial := handshake(t, "bar.test"); serial != 2 {
+			t.Errorf("expected certificate 2 for bar.test, got %d", serial)
+		}
+
+		if serial := handshake(t, "unknown.test"); serial != 1 {
+			t.Errorf("expected default certificate 1 for unknown.test, got %d", serial)
+		}
+	})
+
+	t.Run("serves requests", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", address, &tls.Config{ServerName: "foo.test", InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: foo.test\r\nConnection: close\r\n\r\n")
+		if err != nil {
+			t.Fatalf("failed to write request: %v", err)
+		}
+
+		body, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: 6\r\n\r\nsecure"
+		if withoutDate(string(body)) != expected {
+			t.Errorf("expected %q, got %q", expected, body)
+		}
+	})
+
+	t.Run("reloads certificate changed on disk", func(t *testing.T) {
+		writeCertificate(t, dir, "foo.test", 3)
+		// make sure the modification time changes even on coarse grained file systems
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(fooCert.CertFile, later, later)
+		os.Chtimes(fooCert.KeyFile, later, later)
+		time.Sleep(20 * time.Millisecond)
+
+		if serial := handshake(t, "foo.test"); serial != 3 {
+			t.Errorf("expected reloaded certificate 3 for foo.test, got %d", serial)
+		}
+	})
+}
@@ -0,0 +1,281 @@
+package http
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// {name} matches a single path segment, {name:constraint} a segment
+	// satisfying the constraint and {name...} the rest of the path
+	pathVariableRegex = regexp.MustCompile(`^{([^{}.:]+)(?::(.+?))?(\.\.\.)?}$`)
+
+	// named constraints; any other constraint is a regular expression the
+	// whole segment must match
+	namedConstraints = map[string]func(string) bool{
+		"int": func(segment string) bool {
+			_, err := strconv.Atoi(segment)
+			return err == nil
+		},
+		"uuid": regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+	}
+)
+
+// node is a node of the routing tree. Every node stands for one path segment
+// of the registered patterns, so that finding a route costs one map lookup
+// per segment of the request path regardless of how many routes there are.
+//
+// When several children match a segment, static segments win over
+// constrained parameters, which win over parameters, which win over
+// catch-alls. Constrained parameters are tried in the order they were added.
+// If the preferred child leads to a dead end, the next one is tried.
+type node struct {
+	// name of the parameter for param and catch-all nodes
+	name string
+	// path of the pattern the node was created for, or of the first route
+	// ending at it; used in error and log messages
+	path string
+
+	static      map[string]*node
+	constrained []*node
+	param       *node
+	catchAll    *node
+
+	// constraint of a constrained param node as written in the pattern, and
+	// the function checking a segment against it
+	constraint string
+	matches    func(segment string) bool
+
+	// handlers of the routes ending at this node, by method
+	handlers map[string]Handler
+
+	// mux mounted at the path of the node, with the middlewares of the group
+	// it was mounted in
+	mounted     *node
+	sub         *Mux
+	middlewares []Middleware
+}
+
+func newNode(name, path string) *node {
+	return &node{
+		name:   name,
+		path:   path,
+		static: make(map[string]*node),
+	}
+}
+
+// insert registers handler for method and the pattern path.
+func (n *node) insert(method, path string, handler Handler) error {
+	current, insertErr := n.insertPath(path)
+	if insertErr != nil {
+		return insertErr
+	}
+
+	if current.handlers == nil {
+		current.handlers = make(map[string]Handler)
+		current.path = path
+	}
+
+	_, exists := current.handlers[method]
+	if exists {
+		return fmt.Errorf("route pattern \"%s %s\" already exists", method, path)
+	}
+	current.handlers[method] = handler
+
+	return nil
+}
+
+// mount registers sub for the requests whose path starts with prefix.
+func (n *node) mount(prefix string, sub *Mux, middlewares []Middleware) error {
+	if strings.Contains(prefix, "...}") {
+		return fmt.Errorf("\"%v\" is invalid. a mount prefix cannot end with a {name...} variable", prefix)
+	}
+
+	current, insertErr := n.insertPath(prefix)
+	if insertErr != nil {
+		return insertErr
+	}
+
+	if current.mounted != nil {
+		return fmt.Errorf("a mux is already mounted at \"%v\"", current.mounted.path)
+	}
+
+	current.mounted = newNode("", prefix)
+	current.mounted.sub = sub
+	current.mounted.middlewares = middlewares
+
+	return nil
+}
+
+// insertPath returns the node for the pattern path, creating the missing
+// nodes along the way.
+func (n *node) insertPath(path string) (*node, error) {
+	segments := splitPattern(path)
+
+	current := n
+	for i, segment := range segments {
+		matches := pathVariableRegex.FindStringSubmatch(segment)
+
+		switch {
+		case len(matches) == 0:
+			if strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("\"%v\" is invalid. segment \"%v\" is not a valid path variable", path, segment)
+			}
+
+			child, exists := current.static[segment]
+			if !exists {
+				child = newNode("", path)
+				current.static[segment] = child
+			}
+			current = child
+
+		case matches[2] != "":
+			if matches[3] != "" {
+				return nil, fmt.Errorf("\"%v\" is invalid. {%v...} cannot have a constraint", path, matches[1])
+			}
+
+			child, childErr := current.constrainedChild(matches[1], matches[2], path)
+			if childErr != nil {
+				return nil, childErr
+			}
+			current = child
+
+		case matches[3] == "":
+			if current.param == nil {
+				current.param = newNode(matches[1], path)
+			} else if current.param.name != matches[1] {
+				return nil, fmt.Errorf("path variable {%v} in \"%v\" conflicts with {%v} in \"%v\"",
+					matches[1], path, current.param.name, current.param.path)
+			}
+			current = current.param
+
+		default:
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("\"%v\" is invalid. {%v...} must be the last segment", path, matches[1])
+			}
+
+			if current.catchAll == nil {
+				current.catchAll = newNode(matches[1], path)
+			} else if current.catchAll.name != matches[1] {
+				return nil, fmt.Errorf("path variable {%v...} in \"%v\" conflicts with {%v...} in \"%v\"",
+					matches[1], path, current.catchAll.name, current.catchAll.path)
+			}
+			current = current.catchAll
+		}
+	}
+
+	return current, nil
+}
+
+// constrainedChild returns the child for the path variable {name:constraint},
+// adding it if the node has none.
+func (n *node) constrainedChild(name, constraint, path string) (*node, error) {
+	for _, child := range n.constrained {
+		if child.constraint != constraint {
+			continue
+		}
+
+		if child.name != name {
+			return nil, fmt.Errorf("path variable {%v:%v} in \"%v\" conflicts with {%v:%v} in \"%v\"",
+				name, constraint, path, child.name, child.constraint, child.path)
+		}
+		return child, nil
+	}
+
+	matches, exists := namedConstraints[constraint]
+	if !exists {
+		re, compileErr := regexp.Compile("^(?:" + constraint + ")$")
+		if compileErr != nil {
+			return nil, fmt.Errorf("\"%v\" is invalid. constraint of {%v} is not a valid regular expression: %w",
+				path, name, compileErr)
+		}
+		matches = re.MatchString
+	}
+
+	child := newNode(name, path)
+	child.constraint = constraint
+	child.matches = matches
+	n.constrained = append(n.constrained, child)
+
+	return child, nil
+}
+
+// handler returns the handler of the route ending at the node for method.
+// HEAD requests are handled by the GET route unless there is a HEAD route;
+// the server then leaves out the body.
+func (n *node) handler(method string) Handler {
+	handler, exists := n.handlers[method]
+	if !exists && method == "HEAD" {
+		handler = n.handlers["GET"]
+	}
+
+	return handler
+}
+
+// find returns the node of the route matching the decoded path segments
+// for which accept returns true, filling params with the path variables.
+// It returns nil when there is no such route.
+//
+// Mounted muxes are tried after the routes of the tree, with rest holding
+// the segments left for the mounted mux.
+func (n *node) find(segments []string, params map[string]string, accept func(n *node, rest []string) bool) *node {
+	if len(segments) == 0 && n.handlers != nil && accept(n, nil) {
+		return n
+	}
+
+	if len(segments) > 0 {
+		segment := segments[0]
+
+		child, exists := n.static[segment]
+		if exists {
+			found := child.find(segments[1:], params, accept)
+			if found != nil {
+				return found
+			}
+		}
+
+		for _, child := range n.constrained {
+			if !child.matches(segment) {
+				continue
+			}
+
+			found := child.find(segments[1:], params, accept)
+			if found != nil {
+				params[child.name] = segment
+				return found
+			}
+		}
+
+		if n.param != nil {
+			found := n.param.find(segments[1:], params, accept)
+			if found != nil {
+				params[n.param.name] = segment
+				return found
+			}
+		}
+
+		if n.catchAll != nil && accept(n.catchAll, nil) {
+			params[n.catchAll.name] = strings.Join(segments, "/")
+			return n.catchAll
+		}
+	}
+
+	if n.mounted != nil && accept(n.mounted, segments) {
+		return n.mounted
+	}
+
+	return nil
+}
+
+// splitPattern splits the path of a pattern into segments. The root path
+// has no segments.
+func splitPattern(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+
+	return strings.Split(trimmed, "/")
+}
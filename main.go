@@ -6,21 +6,66 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/codecrafters-io/http-server-starter-go/app"
+	"github.com/codecrafters-io/http-server-starter-go/http"
 )
 
 const (
 	PORT = 4221
+
+	READ_HEADER_TIMEOUT = 10 * time.Second
+	READ_BODY_TIMEOUT   = 60 * time.Second
+	WRITE_TIMEOUT       = 60 * time.Second
+	IDLE_TIMEOUT        = 2 * time.Minute
+
+	MAX_CONNS        = 1024
+	MAX_CONNS_PER_IP = 128
+
+	SERVER_HEADER = "http-server-starter-go"
 )
 
 var (
-	directory = flag.String("directory", "", "--directory /tmp")
+	directory       = flag.String("directory", "", "--directory /tmp")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "--shutdown-timeout 10s")
+	tlsCerts        stringsFlag
+	tlsKeys         stringsFlag
 )
 
+// stringsFlag collects the values of a flag that can be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 func main() {
+	flag.Var(&tlsCerts, "tls-cert", "--tls-cert /path/to/cert.pem (repeat for multiple hostnames)")
+	flag.Var(&tlsKeys, "tls-key", "--tls-key /path/to/key.pem (one per --tls-cert)")
 	flag.Parse()
 
+	if len(tlsCerts) != len(tlsKeys) {
+		fmt.Println("every --tls-cert must have a matching --tls-key")
+		os.Exit(1)
+	}
+
+	var certificates []http.CertificateFiles
+	for i := range tlsCerts {
+		certificates = append(certificates, http.CertificateFiles{
+			CertFile: tlsCerts[i],
+			KeyFile:  tlsKeys[i],
+		})
+	}
+
 	if *directory != "" {
 		_, err := os.Stat(*directory)
 		if errors.Is(err, os.ErrNotExist) {
@@ -32,26 +77,49 @@ func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
 
 	config := &app.Config{
-		Directory: *directory,
-		Logger:    logger,
-		Port:      PORT,
+		Directory:       *directory,
+		Logger:          logger,
+		Port:            PORT,
+		ShutdownTimeout: *shutdownTimeout,
+
+		ReadHeaderTimeout: READ_HEADER_TIMEOUT,
+		ReadBodyTimeout:   READ_BODY_TIMEOUT,
+		WriteTimeout:      WRITE_TIMEOUT,
+		IdleTimeout:       IDLE_TIMEOUT,
+
+		MaxConns:      MAX_CONNS,
+		MaxConnsPerIP: MAX_CONNS_PER_IP,
+
+		TLSCertificates: certificates,
+
+		ServerHeader: SERVER_HEADER,
 	}
 
 	myApp := app.NewApp(config)
 
 	// wait for termination signals to properly stop the server
-	// go func() {
-	// 	sigChan := make(chan os.Signal, 1)
-	// 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
 
-	// 	<-sigChan
-	// 	logger.Info("received shutdown signal, stopping server...")
-	// 	myApp.Stop()
-	// }()
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+		<-sigChan
+		logger.Info("received shutdown signal, stopping server...")
+		err := myApp.Stop()
+		if err != nil {
+			logger.Error("cannot stop application gracefully", "error", err)
+		}
+	}()
 
 	err := myApp.Start()
 	if err != nil {
 		logger.Error("cannot start application", "error", err)
 		os.Exit(1)
 	}
+
+	// Start returns as soon as the listener is closed; wait for in-flight
+	// requests to be drained.
+	<-stopped
 }